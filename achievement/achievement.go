@@ -0,0 +1,309 @@
+// Package achievement unlocks goals, such as reaching a level or a score,
+// when conditions over the memory and registers of the VM are met, in the
+// manner of RetroAchievements. Achievements are defined in a JSON file that
+// lists them by the SHA-1 hash of the ROM they belong to, so that a ROM gets
+// goals without being modified:
+//
+//	{
+//	  "<sha1>": [{
+//	    "ID": "level3",
+//	    "Title": "Halfway there",
+//	    "Conditions": [
+//	      {"Left": "[2A4]", "Cmp": ">", "Right": "d[2A4]"},
+//	      {"Left": "[2A4]", "Cmp": "=", "Right": "3"}
+//	    ]
+//	  }]
+//	}
+//
+// An operand is a byte of memory such as `[2A4]`, a register (`V0` to `VF`,
+// `I`, `DT` or `ST`), the value either had at the end of the previous frame
+// when prefixed with `d` for delta, e.g. `d[2A4]` or `dV3`, or a constant in
+// decimal or in hex, e.g. `12` or `0x0C`.
+package achievement
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+// A Condition compares two operands at the end of each frame.
+type Condition struct {
+	Left  string
+	Cmp   string // one of =, !=, <, <=, > and >=
+	Right string
+	Hits  int  `json:",omitempty"` // the number of frames the condition has to be true for, in a row or not
+	Reset bool `json:",omitempty"` // the condition resets the hits of the achievement when true instead of being required
+
+	left, right operand
+	hits        int
+}
+
+// An Achievement is unlocked at the end of the first frame all its required
+// conditions are met.
+type Achievement struct {
+	ID          string
+	Title       string
+	Description string `json:",omitempty"`
+	Conditions  []Condition
+	Unlocked    bool `json:"-"`
+}
+
+// operand sources besides memory, whose address is the source itself
+const (
+	constant = -1 - iota
+	regI
+	regDT
+	regST
+	regV0 // VF is regV0 - 0xF
+)
+
+type operand struct {
+	source int
+	value  int  // the value of a constant
+	delta  bool // the value at the end of the previous frame
+}
+
+func parseOperand(s string) (operand, error) {
+	op := operand{}
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if strings.HasPrefix(s, "D") && s != "DT" {
+		op.delta = true
+		s = s[1:]
+	}
+	switch {
+	case strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]"):
+		addr, err := strconv.ParseUint(s[1:len(s)-1], 16, 16)
+		if err != nil || addr >= chip8.MemorySize {
+			return op, fmt.Errorf("invalid address %s", s)
+		}
+		op.source = int(addr)
+	case s == "I":
+		op.source = regI
+	case s == "DT":
+		op.source = regDT
+	case s == "ST":
+		op.source = regST
+	case len(s) == 2 && s[0] == 'V':
+		x, err := strconv.ParseUint(s[1:], 16, 4)
+		if err != nil {
+			return op, fmt.Errorf("invalid register %s", s)
+		}
+		op.source = regV0 - int(x)
+	default:
+		if op.delta {
+			return op, fmt.Errorf("invalid operand d%s; only memory and registers have deltas", s)
+		}
+		v, err := strconv.ParseUint(s, 0, 16)
+		if err != nil {
+			return op, fmt.Errorf("invalid operand %q", s)
+		}
+		op.source, op.value = constant, int(v)
+	}
+	return op, nil
+}
+
+// state is what operands read: the memory and registers of the VM.
+type state struct {
+	mem    []byte
+	regs   [16]byte
+	i      uint16
+	dt, st byte
+}
+
+func (s *state) save(vm *chip8.Vm) {
+	s.mem = append(s.mem[:0], vm.Mem...)
+	s.regs, s.i, s.dt, s.st = vm.Regs, vm.I, vm.DT, vm.ST
+}
+
+func (s *state) read(op operand) int {
+	switch {
+	case op.source >= 0:
+		return int(s.mem[op.source])
+	case op.source == constant:
+		return op.value
+	case op.source == regI:
+		return int(s.i)
+	case op.source == regDT:
+		return int(s.dt)
+	case op.source == regST:
+		return int(s.st)
+	default:
+		return int(s.regs[regV0-op.source])
+	}
+}
+
+var comparisons = map[string]func(a, b int) bool{
+	"=":  func(a, b int) bool { return a == b },
+	"!=": func(a, b int) bool { return a != b },
+	"<":  func(a, b int) bool { return a < b },
+	"<=": func(a, b int) bool { return a <= b },
+	">":  func(a, b int) bool { return a > b },
+	">=": func(a, b int) bool { return a >= b },
+}
+
+func (c *Condition) compile() error {
+	var err error
+	if c.left, err = parseOperand(c.Left); err != nil {
+		return err
+	}
+	if c.right, err = parseOperand(c.Right); err != nil {
+		return err
+	}
+	if _, ok := comparisons[c.Cmp]; !ok {
+		return fmt.Errorf("invalid comparison %q", c.Cmp)
+	}
+	if c.Hits < 0 {
+		return fmt.Errorf("invalid hit count %d", c.Hits)
+	}
+	return nil
+}
+
+func (c *Condition) test(current, previous *state) bool {
+	read := func(op operand) int {
+		if op.delta {
+			return previous.read(op)
+		}
+		return current.read(op)
+	}
+	return comparisons[c.Cmp](read(c.left), read(c.right))
+}
+
+// Definitions are the achievements of ROMs by their SHA-1 hash.
+type Definitions map[string][]Achievement
+
+// Decode reads the definitions of achievements stored as JSON.
+func Decode(data []byte) (Definitions, error) {
+	defs := Definitions{}
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("invalid achievements: %w", err)
+	}
+	for hash, list := range defs {
+		ids := map[string]bool{}
+		for _, a := range list {
+			if a.ID == "" || a.Title == "" {
+				return nil, fmt.Errorf("achievement of %s without an ID or a title", hash)
+			}
+			if ids[a.ID] {
+				return nil, fmt.Errorf("achievement %s of %s defined twice", a.ID, hash)
+			}
+			ids[a.ID] = true
+			required := 0
+			for i := range a.Conditions {
+				if err := a.Conditions[i].compile(); err != nil {
+					return nil, fmt.Errorf("achievement %s of %s: %w", a.ID, hash, err)
+				}
+				if !a.Conditions[i].Reset {
+					required++
+				}
+			}
+			if required == 0 {
+				return nil, fmt.Errorf("achievement %s of %s has no required condition", a.ID, hash)
+			}
+		}
+	}
+	return defs, nil
+}
+
+// Set returns the achievements of a ROM, all locked; a ROM without
+// achievements has an empty set.
+func (d Definitions) Set(hash string) *Set {
+	s := &Set{}
+	for _, def := range d[hash] {
+		a := def
+		a.Conditions = append([]Condition{}, def.Conditions...)
+		s.Achievements = append(s.Achievements, &a)
+	}
+	return s
+}
+
+// A Set tracks the achievements of a ROM while it runs.
+type Set struct {
+	Achievements []*Achievement
+	previous     *state // the state at the end of the previous frame
+	current      *state
+}
+
+// Update evaluates the conditions of the locked achievements at the end of a
+// frame and returns those it unlocks. A true reset condition clears the hits
+// of all the conditions of its achievement, which is not unlocked that frame.
+func (s *Set) Update(vm *chip8.Vm) []*Achievement {
+	if s.current == nil { // there is no delta yet on the first frame
+		s.previous, s.current = &state{}, &state{}
+		s.previous.save(vm)
+	}
+	s.current.save(vm)
+	unlocked := []*Achievement{}
+	for _, a := range s.Achievements {
+		if a.Unlocked {
+			continue
+		}
+		reset := false
+		for i := range a.Conditions {
+			if c := &a.Conditions[i]; c.Reset && c.test(s.current, s.previous) {
+				reset = true
+			}
+		}
+		met := !reset
+		for i := range a.Conditions {
+			c := &a.Conditions[i]
+			switch {
+			case reset:
+				c.hits = 0
+			case c.Reset:
+			case c.Hits == 0:
+				met = met && c.test(s.current, s.previous)
+			default:
+				if c.hits < c.Hits && c.test(s.current, s.previous) {
+					c.hits++
+				}
+				met = met && c.hits == c.Hits
+			}
+		}
+		if met {
+			a.Unlocked = true
+			unlocked = append(unlocked, a)
+		}
+	}
+	s.previous, s.current = s.current, s.previous
+	return unlocked
+}
+
+// Attach evaluates the achievements at the end of each frame of a VM and
+// calls unlock with those unlocked; it returns the function detaching the set.
+func (s *Set) Attach(vm *chip8.Vm, unlock func(a *Achievement)) (detach func()) {
+	return vm.OnFrame(func(vm *chip8.Vm) {
+		for _, a := range s.Update(vm) {
+			unlock(a)
+		}
+	})
+}
+
+// Unlocked returns the IDs of the achievements unlocked, sorted, e.g. to save
+// them as JSON with the progress of a player.
+func (s *Set) Unlocked() []string {
+	ids := []string{}
+	for _, a := range s.Achievements {
+		if a.Unlocked {
+			ids = append(ids, a.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Restore unlocks the achievements saved as unlocked; unknown IDs are
+// ignored.
+func (s *Set) Restore(ids []string) {
+	for _, a := range s.Achievements {
+		for _, id := range ids {
+			if a.ID == id {
+				a.Unlocked = true
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package achievement
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+const definitions = `{
+	"abc": [
+		{"ID": "up", "Title": "Going up", "Conditions": [
+			{"Left": "[300]", "Cmp": ">", "Right": "d[300]"},
+			{"Left": "[300]", "Cmp": ">=", "Right": "0x03"}
+		]},
+		{"ID": "hold", "Title": "Hold on", "Conditions": [
+			{"Left": "V3", "Cmp": "=", "Right": "1", "Hits": 3},
+			{"Left": "V4", "Cmp": "!=", "Right": "0", "Reset": true}
+		]}
+	]
+}`
+
+func TestUpdate(t *testing.T) {
+	defs, err := Decode([]byte(definitions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, _ := chip8.NewVm([]byte{}, &chip8.HeadlessIO{})
+	set := defs.Set("abc")
+	var unlocked []string
+	set.Attach(&vm, func(a *Achievement) { unlocked = append(unlocked, a.ID) })
+
+	frame := func(mem300, v3, v4 byte) {
+		vm.Mem[0x300], vm.Regs[3], vm.Regs[4] = mem300, v3, v4
+		vm.RunFrame(chip8.RunParams{InstCount: 1})
+	}
+	frame(3, 1, 0) // no delta on the first frame
+	frame(3, 1, 0)
+	frame(3, 0, 1) // the hits are reset
+	frame(4, 1, 0)
+	if !reflect.DeepEqual(unlocked, []string{"up"}) {
+		t.Errorf("Update err; unlocked %v after the reset", unlocked)
+	}
+	frame(4, 1, 0)
+	frame(4, 0, 0)
+	frame(4, 1, 0)
+	if !reflect.DeepEqual(unlocked, []string{"up", "hold"}) {
+		t.Errorf("Update err; unlocked %v", unlocked)
+	}
+
+	other := defs.Set("abc")
+	other.Restore(set.Unlocked())
+	if other.Update(&vm); !reflect.DeepEqual(other.Unlocked(), []string{"hold", "up"}) || len(defs.Set("xyz").Achievements) != 0 {
+		t.Errorf("Restore err; %v", other.Unlocked())
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, bad := range []string{
+		`{"abc": [{"ID": "a", "Title": "A", "Conditions": [{"Left": "[1000]", "Cmp": "=", "Right": "1"}]}]}`,
+		`{"abc": [{"ID": "a", "Title": "A", "Conditions": [{"Left": "[FFF]", "Cmp": "=", "Right": "1"}]}]}`,
+		`{"abc": [{"ID": "a", "Title": "A", "Conditions": [{"Left": "VG", "Cmp": "=", "Right": "1"}]}]}`,
+		`{"abc": [{"ID": "a", "Title": "A", "Conditions": [{"Left": "V0", "Cmp": "==", "Right": "1"}]}]}`,
+		`{"abc": [{"ID": "a", "Title": "A", "Conditions": [{"Left": "V0", "Cmp": "=", "Right": "d1"}]}]}`,
+		`{"abc": [{"ID": "a", "Title": "A", "Conditions": [{"Left": "V0", "Cmp": "=", "Right": "1", "Reset": true}]}]}`,
+		`{"abc": [{"ID": "a", "Title": "A", "Conditions": [{"Left": "V0", "Cmp": "=", "Right": "1"}]},
+			{"ID": "a", "Title": "B", "Conditions": [{"Left": "V0", "Cmp": "=", "Right": "2"}]}]}`,
+	} {
+		if _, err := Decode([]byte(bad)); err == nil {
+			t.Errorf("Decode err; %s accepted", bad)
+		}
+	}
+	for _, operand := range []string{"dDT", "DT", "I", "dVf", "st", "0x1F", "12"} {
+		if _, err := parseOperand(operand); err != nil {
+			t.Errorf("Decode err; %s: %v", operand, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package capture
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// SampleRate is the rate of the synthesised buzzer sound; it is a multiple of
+// the frame rate so that every frame lasts a whole number of samples.
+const SampleRate = 44100
+
+// SamplesPerFrame is the number of audio samples in a frame.
+const SamplesPerFrame = SampleRate / FrameRate
+
+// A Beeper synthesises the buzzer as an 8-bit unsigned square wave, one frame
+// at a time.
+type Beeper struct {
+	Frequency float64 // the pitch of the buzzer in Hz; 440 when zero
+	phase     float64 // the position within the period of the wave, from 0 to 1
+}
+
+// Frame returns the samples of a frame during which the buzzer sounds or not.
+// The wave carries on from the previous frame so that consecutive beeps do not
+// click.
+func (b *Beeper) Frame(buzzing bool) []byte {
+	freq := b.Frequency
+	if freq == 0 {
+		freq = 440
+	}
+	samples := make([]byte, SamplesPerFrame)
+	for i := range samples {
+		samples[i] = 0x80
+		if !buzzing {
+			continue
+		}
+		if b.phase < 0.5 {
+			samples[i] = 0x80 + 0x30
+		} else {
+			samples[i] = 0x80 - 0x30
+		}
+		b.phase += freq / SampleRate
+		b.phase -= float64(int(b.phase))
+	}
+	if !buzzing {
+		b.phase = 0
+	}
+	return samples
+}
+
+// waveFormat is the WAVEFORMATEX structure describing the samples of the
+// beeper, used by both WAV and AVI files.
+type waveFormat struct {
+	FormatTag      uint16
+	Channels       uint16
+	SamplesPerSec  uint32
+	AvgBytesPerSec uint32
+	BlockAlign     uint16
+	BitsPerSample  uint16
+}
+
+var beeperFormat = waveFormat{
+	FormatTag:      1, // PCM
+	Channels:       1,
+	SamplesPerSec:  SampleRate,
+	AvgBytesPerSec: SampleRate,
+	BlockAlign:     1,
+	BitsPerSample:  8,
+}
+
+// WriteWAV encodes samples made by a Beeper as a WAV file.
+func WriteWAV(w io.Writer, samples []byte) error {
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(4 + 8 + 16 + 8 + len(samples) + len(samples)%2),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),
+		beeperFormat,
+		[4]byte{'d', 'a', 't', 'a'},
+		uint32(len(samples)),
+	}
+	for _, v := range header {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(samples); err != nil {
+		return err
+	}
+	if len(samples)%2 != 0 { // RIFF chunks are padded to an even size
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/render"
+)
+
+type fourCC [4]byte
+
+func cc(s string) fourCC {
+	return fourCC{s[0], s[1], s[2], s[3]}
+}
+
+type aviMainHeader struct {
+	MicroSecPerFrame    uint32
+	MaxBytesPerSec      uint32
+	PaddingGranularity  uint32
+	Flags               uint32
+	TotalFrames         uint32
+	InitialFrames       uint32
+	Streams             uint32
+	SuggestedBufferSize uint32
+	Width               uint32
+	Height              uint32
+	Reserved            [4]uint32
+}
+
+type aviStreamHeader struct {
+	Type                fourCC
+	Handler             fourCC
+	Flags               uint32
+	Priority            uint16
+	Language            uint16
+	InitialFrames       uint32
+	Scale               uint32
+	Rate                uint32
+	Start               uint32
+	Length              uint32
+	SuggestedBufferSize uint32
+	Quality             int32
+	SampleSize          uint32
+	Frame               [4]int16
+}
+
+type bitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+type aviIndexEntry struct {
+	ID     fourCC
+	Flags  uint32
+	Offset uint32 // from the `movi` list type
+	Size   uint32
+}
+
+const aviKeyFrame = 0x10
+
+// An AVIWriter encodes frames of the display and the sound of the buzzer as
+// an uncompressed AVI video. The sizes stored in the headers are only known
+// at the end, so the writer has to be seekable and the video is complete
+// once closed.
+type AVIWriter struct {
+	w        io.WriteSeeker
+	renderer *render.Renderer
+	frame    []byte // the DIB of a frame: bottom-up rows of BGR pixels
+	stride   int
+	pos      uint32 // the position in the file
+	movi     uint32 // the position of the `movi` list type
+	index    []aviIndexEntry
+	frames   uint32
+	samples  uint32
+
+	// the positions of the fields patched when closing the writer
+	riffSize, totalFrames, videoLength, audioLength, moviSize uint32
+}
+
+// NewAVIWriter writes the headers of a video to w, which has to be empty.
+func NewAVIWriter(w io.WriteSeeker, opts render.Options) (*AVIWriter, error) {
+	a := &AVIWriter{w: w, renderer: render.New(opts)}
+	opts = a.renderer.Options()
+	width, height := 64*opts.Scale, 32*opts.Scale
+	a.stride = (width*3 + 3) &^ 3
+	a.frame = make([]byte, a.stride*height)
+	frameSize := uint32(len(a.frame))
+
+	var hdr bytes.Buffer
+	put := func(vs ...any) {
+		for _, v := range vs {
+			binary.Write(&hdr, binary.LittleEndian, v)
+		}
+	}
+	at := func() uint32 { return uint32(hdr.Len()) }
+
+	put(cc("RIFF"))
+	a.riffSize = at()
+	put(uint32(0), cc("AVI "))
+	put(cc("LIST"), uint32(4+(8+56)+(8+116)+(8+94)), cc("hdrl"))
+	put(cc("avih"), uint32(56))
+	a.totalFrames = at() + 16
+	put(aviMainHeader{
+		MicroSecPerFrame:    1000000 / FrameRate,
+		MaxBytesPerSec:      (frameSize + SamplesPerFrame) * FrameRate,
+		Flags:               0x10, // has an index
+		Streams:             2,
+		SuggestedBufferSize: frameSize,
+		Width:               uint32(width),
+		Height:              uint32(height),
+	})
+
+	put(cc("LIST"), uint32(116), cc("strl"))
+	put(cc("strh"), uint32(56))
+	a.videoLength = at() + 32
+	put(aviStreamHeader{
+		Type:                cc("vids"),
+		Handler:             cc("DIB "),
+		Scale:               1,
+		Rate:                FrameRate,
+		SuggestedBufferSize: frameSize,
+		Quality:             -1,
+		Frame:               [4]int16{0, 0, int16(width), int16(height)},
+	})
+	put(cc("strf"), uint32(40), bitmapInfoHeader{
+		Size:      40,
+		Width:     int32(width),
+		Height:    int32(height),
+		Planes:    1,
+		BitCount:  24,
+		SizeImage: frameSize,
+	})
+
+	put(cc("LIST"), uint32(94), cc("strl"))
+	put(cc("strh"), uint32(56))
+	a.audioLength = at() + 32
+	put(aviStreamHeader{
+		Type:                cc("auds"),
+		Scale:               1,
+		Rate:                SampleRate,
+		SuggestedBufferSize: SamplesPerFrame + 1,
+		Quality:             -1,
+		SampleSize:          1,
+	})
+	put(cc("strf"), uint32(18), beeperFormat, uint16(0))
+
+	put(cc("LIST"))
+	a.moviSize = at()
+	put(uint32(0))
+	a.movi = at()
+	put(cc("movi"))
+
+	if err := a.write(hdr.Bytes()); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AVIWriter) write(data []byte) error {
+	n, err := a.w.Write(data)
+	a.pos += uint32(n)
+	return err
+}
+
+func (a *AVIWriter) writeChunk(id fourCC, data []byte) error {
+	a.index = append(a.index, aviIndexEntry{id, aviKeyFrame, a.pos - a.movi, uint32(len(data))})
+	header := make([]byte, 8)
+	copy(header, id[:])
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(data)))
+	if err := a.write(header); err != nil {
+		return err
+	}
+	if err := a.write(data); err != nil {
+		return err
+	}
+	if len(data)%2 != 0 { // chunks are padded to an even size
+		return a.write([]byte{0})
+	}
+	return nil
+}
+
+// WriteFrame adds a frame of the display along with the samples of the
+// buzzer played during that frame, as made by a Beeper.
+func (a *AVIWriter) WriteFrame(pixels chip8.Pixels, sound []byte) error {
+	a.renderer.Render(render.FromPixels(&pixels))
+	img := a.renderer.Image()
+	height := img.Rect.Dy()
+	for y := 0; y < height; y++ {
+		row := a.frame[(height-1-y)*a.stride:]
+		for x := 0; x < img.Rect.Dx(); x++ {
+			c := img.RGBAAt(x, y)
+			row[x*3], row[x*3+1], row[x*3+2] = c.B, c.G, c.R
+		}
+	}
+	if err := a.writeChunk(cc("00db"), a.frame); err != nil {
+		return err
+	}
+	a.frames++
+	if len(sound) > 0 {
+		if err := a.writeChunk(cc("01wb"), sound); err != nil {
+			return err
+		}
+		a.samples += uint32(len(sound))
+	}
+	return nil
+}
+
+// Close writes the index of the video and completes its headers. It does not
+// close the underlying writer.
+func (a *AVIWriter) Close() error {
+	moviEnd := a.pos
+	var idx bytes.Buffer
+	binary.Write(&idx, binary.LittleEndian, cc("idx1"))
+	binary.Write(&idx, binary.LittleEndian, uint32(len(a.index)*16))
+	binary.Write(&idx, binary.LittleEndian, a.index)
+	if err := a.write(idx.Bytes()); err != nil {
+		return err
+	}
+
+	patches := []struct{ pos, value uint32 }{
+		{a.riffSize, a.pos - 8},
+		{a.totalFrames, a.frames},
+		{a.videoLength, a.frames},
+		{a.audioLength, a.samples},
+		{a.moviSize, moviEnd - a.movi},
+	}
+	for _, p := range patches {
+		if _, err := a.w.Seek(int64(p.pos), io.SeekStart); err != nil {
+			return err
+		}
+		if err := binary.Write(a.w, binary.LittleEndian, p.value); err != nil {
+			return err
+		}
+	}
+	_, err := a.w.Seek(int64(a.pos), io.SeekStart)
+	return err
+}
+
+// Frames returns the number of frames written.
+func (a *AVIWriter) Frames() int {
+	return int(a.frames)
+}
@@ -0,0 +1,97 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/render"
+)
+
+// fileBuffer is an in-memory io.WriteSeeker.
+type fileBuffer struct {
+	data []byte
+	pos  int
+}
+
+func (f *fileBuffer) Write(p []byte) (int, error) {
+	for len(f.data) < f.pos+len(p) {
+		f.data = append(f.data, 0)
+	}
+	copy(f.data[f.pos:], p)
+	f.pos += len(p)
+	return len(p), nil
+}
+
+func (f *fileBuffer) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart {
+		return 0, errors.New("unsupported whence")
+	}
+	f.pos = int(offset)
+	return offset, nil
+}
+
+func TestAVIWriter(t *testing.T) {
+	var f fileBuffer
+	a, err := NewAVIWriter(&f, render.Options{Scale: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixels := chip8.Pixels{}
+	pixels[0][0] = 1
+	beeper := Beeper{}
+	for i := 0; i < 3; i++ {
+		if err := a.WriteFrame(pixels, beeper.Frame(i == 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	u32 := func(pos uint32) uint32 { return binary.LittleEndian.Uint32(f.data[pos:]) }
+	if string(f.data[:4]) != "RIFF" || int(u32(4)) != len(f.data)-8 || string(f.data[8:12]) != "AVI " {
+		t.Fatalf("AVI err; invalid RIFF header")
+	}
+	if u32(a.totalFrames) != 3 || u32(a.videoLength) != 3 || u32(a.audioLength) != 3*SamplesPerFrame {
+		t.Errorf("AVI err; frames: %d, audio samples: %d", u32(a.totalFrames), u32(a.audioLength))
+	}
+	if string(f.data[a.movi:a.movi+4]) != "movi" || string(f.data[a.movi+4:a.movi+8]) != "00db" {
+		t.Fatalf("AVI err; invalid movi list")
+	}
+	// the top left pixel is the first of the last row of the bottom-up DIB
+	frame := f.data[a.movi+12 : a.movi+12+64*32*3]
+	if last := frame[31*64*3:]; last[0] != 0 || frame[0] != 0xFF {
+		t.Errorf("AVI err; frame not stored bottom-up")
+	}
+	idx := a.movi + u32(a.moviSize)
+	if string(f.data[idx:idx+4]) != "idx1" || u32(idx+4) != 6*16 {
+		t.Errorf("AVI err; invalid index")
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	beeper := Beeper{}
+	samples := append(beeper.Frame(false), beeper.Frame(true)...)
+	if samples[0] != 0x80 || samples[SamplesPerFrame] == 0x80 {
+		t.Errorf("Beeper err; silence: %x, beep: %x", samples[0], samples[SamplesPerFrame])
+	}
+
+	var buf bytes.Buffer
+	if err := WriteWAV(&buf, samples); err != nil {
+		t.Fatal(err)
+	}
+	wav := buf.Bytes()
+	if string(wav[:4]) != "RIFF" || int(binary.LittleEndian.Uint32(wav[4:])) != len(wav)-8 {
+		t.Errorf("WAV err; invalid RIFF header")
+	}
+	if rate := binary.LittleEndian.Uint32(wav[24:]); rate != SampleRate {
+		t.Errorf("WAV err; sample rate: %d", rate)
+	}
+	if size := binary.LittleEndian.Uint32(wav[40:]); int(size) != len(samples) || len(wav) != 44+len(samples) {
+		t.Errorf("WAV err; data size: %d", size)
+	}
+}
@@ -0,0 +1,113 @@
+// Package capture records the display of the VM as PNG screenshots and
+// animated GIFs.
+package capture
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/render"
+)
+
+// FrameRate is the rate at which the VM refreshes its display.
+const FrameRate = 60
+
+// minDelay is the shortest delay of a GIF frame browsers play as is, in
+// hundredths of a second; they slow shorter frames down to 10.
+const minDelay = 2
+
+// WritePNG encodes a screenshot of the display as a PNG image.
+func WritePNG(w io.Writer, pixels chip8.Pixels, opts render.Options) error {
+	return WriteFramePNG(w, render.FromPixels(&pixels), opts)
+}
+
+// WriteFramePNG encodes any frame, such as a sprite sheet, as a PNG image.
+func WriteFramePNG(w io.Writer, f render.Frame, opts render.Options) error {
+	opts.Ghosting = 0
+	r := render.New(opts)
+	r.Render(f)
+	return png.Encode(w, r.Image())
+}
+
+// A Recorder captures successive frames of the display into an animated GIF.
+// Identical consecutive frames are merged into one displayed for longer, and
+// frames too short for a GIF are replaced by the next one, so that an
+// animation changing every frame plays at 30 frames per second.
+type Recorder struct {
+	renderer *render.Renderer
+	anim     gif.GIF
+	count    int // the number of frames captured
+}
+
+func NewRecorder(opts render.Options) *Recorder {
+	return &Recorder{renderer: render.New(opts)}
+}
+
+// Capture records a frame; it has to be called once per frame of the VM so
+// that the animation plays at the right speed.
+func (r *Recorder) Capture(pixels chip8.Pixels) {
+	changed := r.renderer.Render(render.FromPixels(&pixels))
+	r.count++
+	delay, last := frameDelay(r.count-1), len(r.anim.Image)-1
+	switch {
+	case last >= 0 && changed.Empty():
+		r.anim.Delay[last] += delay
+	case last >= 0 && r.anim.Delay[last] < minDelay:
+		r.anim.Image[last] = paletted(r.renderer.Image())
+		r.anim.Delay[last] += delay
+	default:
+		r.anim.Image = append(r.anim.Image, paletted(r.renderer.Image()))
+		r.anim.Delay = append(r.anim.Delay, delay)
+	}
+}
+
+// frameDelay returns how long the nth frame lasts in hundredths of a second,
+// the unit of GIF delays; rounding the start and end times of each frame
+// keeps the animation from drifting.
+func frameDelay(n int) int {
+	return (n+1)*100/FrameRate - n*100/FrameRate
+}
+
+// Frames returns the number of frames captured.
+func (r *Recorder) Frames() int {
+	return r.count
+}
+
+// WriteGIF encodes the captured frames as an animated GIF looping forever; the
+// last frame lasts at least as long as a GIF can play it.
+func (r *Recorder) WriteGIF(w io.Writer) error {
+	anim := r.anim
+	if last := len(anim.Delay) - 1; last >= 0 && anim.Delay[last] < minDelay {
+		anim.Delay = append([]int{}, anim.Delay...)
+		anim.Delay[last] = minDelay
+	}
+	return gif.EncodeAll(w, &anim)
+}
+
+// paletted converts an image to one using the colours it is made of, falling
+// back to a generic palette if there are too many of them.
+func paletted(img *image.RGBA) *image.Paletted {
+	colors := color.Palette{}
+	seen := map[color.RGBA]bool{}
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		colors = append(colors, c)
+		if len(colors) > 256 {
+			colors = palette.Plan9
+			break
+		}
+	}
+	p := image.NewPaletted(img.Bounds(), colors)
+	draw.Draw(p, p.Rect, img, image.Point{}, draw.Src)
+	return p
+}
@@ -0,0 +1,83 @@
+package capture
+
+import (
+	"bytes"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/render"
+)
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(render.Options{Scale: 2})
+	pixels := chip8.Pixels{}
+	pixels[0][0] = 1
+	for i := 0; i < 3; i++ {
+		r.Capture(pixels)
+	}
+	pixels[0][1] = 1
+	r.Capture(pixels)
+
+	var buf bytes.Buffer
+	if err := r.WriteGIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 2 || anim.Delay[0] != 5 || anim.Delay[1] != 2 {
+		t.Errorf("Recorder err; frames: %d, delays: %v", len(anim.Image), anim.Delay)
+	}
+	if anim.Image[1].Bounds().Dx() != 128 || anim.Image[1].ColorIndexAt(2, 0) == anim.Image[1].ColorIndexAt(4, 0) {
+		t.Error("Recorder err; frame not rendered")
+	}
+}
+
+// TestRecorderDelays checks that an animation changing every frame has no
+// frame too short for browsers to play it at its speed.
+func TestRecorderDelays(t *testing.T) {
+	r := NewRecorder(render.Options{})
+	pixels := chip8.Pixels{}
+	for i := 0; i < FrameRate; i++ {
+		pixels[0][i] ^= 1
+		r.Capture(pixels)
+	}
+	var buf bytes.Buffer
+	if err := r.WriteGIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, delay := range anim.Delay {
+		if delay < 2 {
+			t.Errorf("Recorder err; delays: %v", anim.Delay)
+			break
+		}
+		total += delay
+	}
+	if total != 100 {
+		t.Errorf("Recorder err; the animation lasts %dcs", total)
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	pixels := chip8.Pixels{}
+	pixels[31][63] = 1
+	var buf bytes.Buffer
+	if err := WritePNG(&buf, pixels, render.Options{Scale: 3}); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, _ := img.At(191, 95).RGBA(); img.Bounds().Dx() != 192 || r != 0 {
+		t.Errorf("WritePNG err; size: %v", img.Bounds())
+	}
+}
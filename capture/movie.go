@@ -0,0 +1,79 @@
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Movie is the input of a run: the keys held on each frame. Replaying a
+// movie on a VM with a seeded random source reproduces the run exactly.
+//
+// Movies are stored as text, one change of the keypad per line: the frame
+// the change happens on followed by the hex digits of the keys held from then
+// on, e.g. `120 5 8` presses keys 5 and 8 on frame 120 and `150` releases
+// them on frame 150. Blank lines and lines starting with `#` are ignored.
+type Movie struct {
+	changes []keyChange // sorted by frame
+}
+
+type keyChange struct {
+	frame int
+	keys  [16]bool
+}
+
+// ParseMovie reads a movie in its text form.
+func ParseMovie(r io.Reader) (Movie, error) {
+	m := Movie{}
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		frame, err := strconv.Atoi(fields[0])
+		if err != nil || frame < 0 {
+			return Movie{}, fmt.Errorf("line %d: invalid frame %q", lineNum, fields[0])
+		}
+		change := keyChange{frame: frame}
+		for _, f := range fields[1:] {
+			key, err := strconv.ParseUint(f, 16, 8)
+			if err != nil || key > 0xF {
+				return Movie{}, fmt.Errorf("line %d: invalid key %q", lineNum, f)
+			}
+			change.keys[key] = true
+		}
+		m.changes = append(m.changes, change)
+	}
+	if err := scanner.Err(); err != nil {
+		return Movie{}, err
+	}
+	sort.SliceStable(m.changes, func(i, j int) bool {
+		return m.changes[i].frame < m.changes[j].frame
+	})
+	return m, nil
+}
+
+// Keys returns the keys held on a frame.
+func (m Movie) Keys(frame int) [16]bool {
+	keys := [16]bool{}
+	for _, c := range m.changes {
+		if c.frame > frame {
+			break
+		}
+		keys = c.keys
+	}
+	return keys
+}
+
+// Len returns the frame of the last change of the keypad plus one, i.e. the
+// number of frames needed to play all of the movie.
+func (m Movie) Len() int {
+	if len(m.changes) == 0 {
+		return 0
+	}
+	return m.changes[len(m.changes)-1].frame + 1
+}
@@ -0,0 +1,41 @@
+package capture
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMovie(t *testing.T) {
+	movie, err := ParseMovie(strings.NewReader("# jump\n10 5 a\n\n4 1\n20\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		frame int
+		keys  []int
+	}{
+		{0, nil},
+		{4, []int{1}},
+		{9, []int{1}},
+		{10, []int{5, 0xA}},
+		{25, nil},
+	}
+	for _, c := range checks {
+		expected := [16]bool{}
+		for _, k := range c.keys {
+			expected[k] = true
+		}
+		if keys := movie.Keys(c.frame); keys != expected {
+			t.Errorf("Movie keys err; frame %d: %v", c.frame, keys)
+		}
+	}
+	if movie.Len() != 21 {
+		t.Errorf("Movie length err; Len: %d", movie.Len())
+	}
+
+	for _, bad := range []string{"x 1", "-1", "3 10", "3 g"} {
+		if _, err := ParseMovie(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseMovie err; %q was accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package cheat searches the memory of the VM for the bytes holding game
+// state, such as lives or the level, and changes them with cheat codes.
+package cheat
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+// A Code sets a byte of memory or a register to a value, either once or
+// every frame.
+type Code struct {
+	Name    string `json:",omitempty"`
+	Target  string // a memory address in hex such as `2A4`, or a register such as `V3`
+	Value   byte
+	Freeze  bool // the value is written every frame instead of once
+	Enabled bool
+}
+
+// ParseCode reads a code written as `target=value`, in hex, e.g. `2A4=05`; a
+// trailing `!` freezes the value, e.g. `V3=09!`.
+func ParseCode(s string) (Code, error) {
+	code := Code{Enabled: true}
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "!") {
+		code.Freeze = true
+		s = strings.TrimSuffix(s, "!")
+	}
+	target, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return Code{}, fmt.Errorf("invalid cheat code %q; expected target=value", s)
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(value), 16, 8)
+	if err != nil {
+		return Code{}, fmt.Errorf("invalid cheat value %q", value)
+	}
+	code.Target = strings.ToUpper(strings.TrimSpace(target))
+	code.Value = byte(v)
+	if err := code.validate(); err != nil {
+		return Code{}, err
+	}
+	return code, nil
+}
+
+// validate checks that the target of a code exists and can hold its value,
+// which is a byte: only SP, the depth of the stack, has a smaller range.
+func (c Code) validate() error {
+	if addr, err := strconv.ParseUint(c.Target, 16, 16); err == nil {
+		if addr >= chip8.MemorySize {
+			return fmt.Errorf("address %#x is out of memory", addr)
+		}
+		return nil
+	}
+	switch c.Target {
+	case "I", "PC", "DT", "ST":
+		return nil
+	case "SP":
+		if c.Value > 0x10 {
+			return fmt.Errorf("SP: value %#x is out of range", c.Value)
+		}
+		return nil
+	}
+	if len(c.Target) == 2 && c.Target[0] == 'V' && strings.ContainsRune("0123456789ABCDEF", rune(c.Target[1])) {
+		return nil
+	}
+	return fmt.Errorf("unknown register %s", c.Target)
+}
+
+func (c Code) String() string {
+	s := fmt.Sprintf("%s=%02X", c.Target, c.Value)
+	if c.Freeze {
+		s += "!"
+	}
+	return s
+}
+
+func (c Code) apply(vm *chip8.Vm) error {
+	if addr, err := strconv.ParseUint(c.Target, 16, 16); err == nil {
+		return vm.Poke(uint16(addr), c.Value)
+	}
+	return vm.SetRegister(c.Target, int(c.Value))
+}
+
+// Codes are the cheat codes of a ROM.
+type Codes struct {
+	List    []Code
+	applied []bool // whether each code has been applied since it was enabled
+}
+
+// Decode reads codes stored as JSON, e.g. the cheats saved for a ROM.
+func Decode(data []byte) (*Codes, error) {
+	codes := &Codes{}
+	if err := json.Unmarshal(data, &codes.List); err != nil {
+		return nil, fmt.Errorf("invalid cheat codes: %w", err)
+	}
+	for _, c := range codes.List {
+		if _, err := ParseCode(c.String()); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// Encode stores codes as JSON.
+func (c *Codes) Encode() []byte {
+	list := c.List
+	if list == nil {
+		list = []Code{}
+	}
+	data, _ := json.Marshal(list)
+	return data
+}
+
+func (c *Codes) Add(code Code) {
+	c.List = append(c.List, code)
+}
+
+func (c *Codes) Remove(i int) {
+	if i >= 0 && i < len(c.List) {
+		c.List = append(c.List[:i], c.List[i+1:]...)
+		c.applied = nil
+	}
+}
+
+// SetEnabled enables or disables a code; a code poking its value once pokes
+// it again when enabled anew.
+func (c *Codes) SetEnabled(i int, enabled bool) {
+	if i < 0 || i >= len(c.List) {
+		return
+	}
+	c.List[i].Enabled = enabled
+	if i < len(c.applied) {
+		c.applied[i] = false
+	}
+}
+
+// Apply writes the values of the enabled codes; it is called before each
+// frame so that frozen values hold whatever the program does.
+func (c *Codes) Apply(vm *chip8.Vm) {
+	for len(c.applied) < len(c.List) {
+		c.applied = append(c.applied, false)
+	}
+	for i, code := range c.List {
+		if !code.Enabled || (c.applied[i] && !code.Freeze) {
+			continue
+		}
+		code.apply(vm)
+		c.applied[i] = true
+	}
+}
+
+// Comparison is how a byte has to have changed since the last snapshot of a
+// search to be kept.
+type Comparison int
+
+const (
+	Unchanged Comparison = iota
+	Changed
+	Increased
+	Decreased
+)
+
+// A Search narrows down the addresses of memory that may hold a value: each
+// filter keeps the candidates matching a value or a change since the previous
+// filter, so that a few filters made over frames single the address out.
+type Search struct {
+	snapshot   []byte
+	candidates []uint16
+}
+
+// NewSearch starts a search among all addresses of the program memory.
+func NewSearch(vm *chip8.Vm) *Search {
+	s := &Search{}
+	for addr := 0x200; addr < len(vm.Mem); addr++ {
+		s.candidates = append(s.candidates, uint16(addr))
+	}
+	s.snapshot = append([]byte{}, vm.Mem...)
+	return s
+}
+
+func (s *Search) filter(vm *chip8.Vm, keep func(old, new byte) bool) {
+	kept := s.candidates[:0]
+	for _, addr := range s.candidates {
+		if keep(s.snapshot[addr], vm.Mem[addr]) {
+			kept = append(kept, addr)
+		}
+	}
+	s.candidates = kept
+	copy(s.snapshot, vm.Mem)
+}
+
+// Value keeps the addresses holding a value.
+func (s *Search) Value(vm *chip8.Vm, value byte) {
+	s.filter(vm, func(old, new byte) bool { return new == value })
+}
+
+// Compare keeps the addresses whose value changed as told since the last
+// filter.
+func (s *Search) Compare(vm *chip8.Vm, cmp Comparison) {
+	s.filter(vm, func(old, new byte) bool {
+		switch cmp {
+		case Changed:
+			return new != old
+		case Increased:
+			return new > old
+		case Decreased:
+			return new < old
+		default:
+			return new == old
+		}
+	})
+}
+
+// Results returns the addresses that may hold the value searched for.
+func (s *Search) Results() []uint16 {
+	return s.candidates
+}
@@ -0,0 +1,86 @@
+package cheat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+func TestSearch(t *testing.T) {
+	vm, _ := chip8.NewVm([]byte{0x00, 0x03, 0x03, 0x07}, &chip8.HeadlessIO{})
+	s := NewSearch(&vm)
+	s.Value(&vm, 3)
+	if !reflect.DeepEqual(s.Results(), []uint16{0x201, 0x202}) {
+		t.Errorf("Search err; value results: %x", s.Results())
+	}
+
+	vm.Mem[0x201] = 2
+	s.Compare(&vm, Decreased)
+	if !reflect.DeepEqual(s.Results(), []uint16{0x201}) {
+		t.Errorf("Search err; decreased results: %x", s.Results())
+	}
+	s.Compare(&vm, Unchanged)
+	if len(s.Results()) != 1 {
+		t.Errorf("Search err; unchanged results: %x", s.Results())
+	}
+	s.Compare(&vm, Increased)
+	if len(s.Results()) != 0 {
+		t.Errorf("Search err; increased results: %x", s.Results())
+	}
+}
+
+func TestParseCode(t *testing.T) {
+	code, err := ParseCode(" 2a4 = 5!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != (Code{Target: "2A4", Value: 5, Freeze: true, Enabled: true}) || code.String() != "2A4=05!" {
+		t.Errorf("Parse code err; %+v", code)
+	}
+	for _, bad := range []string{"2A4", "V3=100", "VG=1", "1000=1", "FFF=1", "SP=11", "V=1", "VF0=1"} {
+		if _, err := ParseCode(bad); err == nil {
+			t.Errorf("Parse code err; %q accepted", bad)
+		}
+	}
+	for _, good := range []string{"FFE=1", "SP=10", "vf=FF", "pc=FF", "I=1", "dt=1", "ST=1"} {
+		if _, err := ParseCode(good); err != nil {
+			t.Errorf("Parse code err; %q: %v", good, err)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	vm, _ := chip8.NewVm([]byte{}, &chip8.HeadlessIO{})
+	poke, _ := ParseCode("300=07")
+	freeze, _ := ParseCode("V3=09!")
+	codes := &Codes{}
+	codes.Add(poke)
+	codes.Add(freeze)
+
+	codes.Apply(&vm)
+	if vm.Mem[0x300] != 7 || vm.Regs[3] != 9 {
+		t.Errorf("Apply err; mem: %x, V3: %x", vm.Mem[0x300], vm.Regs[3])
+	}
+	vm.Mem[0x300], vm.Regs[3] = 1, 1
+	codes.Apply(&vm)
+	if vm.Mem[0x300] != 1 || vm.Regs[3] != 9 {
+		t.Errorf("Apply err; poked again or not frozen; mem: %x, V3: %x", vm.Mem[0x300], vm.Regs[3])
+	}
+	codes.SetEnabled(0, true)
+	codes.Apply(&vm)
+	if vm.Mem[0x300] != 7 {
+		t.Errorf("Apply err; not poked when enabled anew")
+	}
+
+	decoded, err := Decode(codes.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.List, codes.List) {
+		t.Errorf("Decode err; %+v", decoded.List)
+	}
+	if _, err := Decode([]byte(`[{"Target": "ZZ", "Value": 1}]`)); err == nil {
+		t.Error("Decode err; invalid target accepted")
+	}
+}
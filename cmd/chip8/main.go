@@ -0,0 +1,198 @@
+// Command chip8 runs a ROM without a display for a number of frames and
+// saves what was displayed as a PNG screenshot, an animated GIF, a sequence
+// of PNG images or an uncompressed AVI video, and the sound of the buzzer as
+// a WAV file. The keys pressed can be replayed from an input movie, and the
+// achievements of the ROM are logged as they are unlocked.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/achievement"
+	"github.com/bobbynarvy/chip8/capture"
+	"github.com/bobbynarvy/chip8/cheat"
+	"github.com/bobbynarvy/chip8/loader"
+	"github.com/bobbynarvy/chip8/render"
+)
+
+func main() {
+	frames := flag.Int("frames", 600, "the number of frames to run")
+	instCount := flag.Int("ipf", 0, "the number of instructions per frame; defaults to the ROM's recommended tickrate")
+	screenshot := flag.String("screenshot", "", "save the last frame as a PNG image to this file")
+	gifFile := flag.String("gif", "", "save all frames as an animated GIF to this file")
+	scale := flag.Int("scale", 4, "the size of a CHIP-8 pixel in image pixels")
+	paletteName := flag.String("palette", "classic", "the palette of the images: classic, inverse, green, amber or octo")
+	ghosting := flag.Int("ghosting", 0, "the number of frames erased pixels take to fade out in the GIF and AVI")
+	sequence := flag.String("sequence", "", "save every frame as a PNG image to files named after this pattern, e.g. frame%05d.png")
+	aviFile := flag.String("avi", "", "save all frames and the buzzer as an uncompressed AVI video to this file")
+	wavFile := flag.String("wav", "", "save the buzzer as a WAV file to this file")
+	movieFile := flag.String("movie", "", "replay the keys pressed from this input movie")
+	seed := flag.Int64("seed", 1, "the seed of the random numbers, so that runs can be reproduced")
+	trace := flag.Bool("trace", false, "print each instruction executed to the standard error")
+	achievementsFile := flag.String("achievements", "", "log the achievements of the ROM defined in this JSON file when they are unlocked")
+	haltPolicy := flag.String("halt", "stop", "what to do when the program is over: stop, notify or continue")
+	cheats := &cheat.Codes{}
+	flag.Func("cheat", "apply a cheat code such as 2A4=05, or V3=09! to freeze a value; can be repeated", func(s string) error {
+		code, err := cheat.ParseCode(s)
+		if err == nil {
+			cheats.Add(code)
+		}
+		return err
+	})
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] rom\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	palette, ok := render.Palettes[*paletteName]
+	if !ok {
+		log.Fatalf("unknown palette %q", *paletteName)
+	}
+	opts := render.Options{Palette: palette, Scale: *scale, Ghosting: *ghosting}
+
+	data, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	rom, err := loader.Load(flag.Arg(0), data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	movie := capture.Movie{}
+	if *movieFile != "" {
+		f, err := os.Open(*movieFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		movie, err = capture.ParseMovie(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", *movieFile, err)
+		}
+	}
+
+	headless := &chip8.HeadlessIO{}
+	vm, params, err := rom.Boot(headless)
+	if err != nil {
+		log.Fatal(err)
+	}
+	vm.Seed(*seed)
+	policy, ok := chip8.HaltPolicies[*haltPolicy]
+	if !ok {
+		log.Fatalf("unknown halt policy %q", *haltPolicy)
+	}
+	vm.Halt.Policy = policy
+	if *trace {
+		vm.OnInstruction(func(vm *chip8.Vm, addr uint16, opcode uint16) {
+			fmt.Fprintln(os.Stderr, vm.Disassemble(addr))
+		})
+	}
+	frame := 0
+	if *achievementsFile != "" {
+		data, err := os.ReadFile(*achievementsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defs, err := achievement.Decode(data)
+		if err != nil {
+			log.Fatalf("%s: %v", *achievementsFile, err)
+		}
+		defs.Set(rom.Metadata.Hash).Attach(&vm, func(a *achievement.Achievement) {
+			log.Printf("frame %d: achievement unlocked: %s", frame, a.Title)
+		})
+	}
+	if *instCount != 0 {
+		params.InstCount = *instCount
+	}
+
+	var recorder *capture.Recorder
+	if *gifFile != "" {
+		recorder = capture.NewRecorder(opts)
+	}
+	var avi *capture.AVIWriter
+	if *aviFile != "" {
+		f, err := os.Create(*aviFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if avi, err = capture.NewAVIWriter(f, opts); err != nil {
+			log.Fatal(err)
+		}
+	}
+	beeper := capture.Beeper{}
+	sound := []byte{}
+	halted := chip8.NotHalted
+	for i := 0; i < *frames && !vm.Done; i++ {
+		frame = i
+		headless.Keys = movie.Keys(i)
+		cheats.Apply(&vm)
+		if err := vm.RunFrame(params); err != nil {
+			log.Fatalf("frame %d: %v", i, err)
+		}
+		if vm.Halted != halted {
+			halted = vm.Halted
+			log.Printf("frame %d: program halted (%v)", i, halted)
+		}
+		samples := beeper.Frame(vm.Buzzing)
+		if *wavFile != "" {
+			sound = append(sound, samples...)
+		}
+		if recorder != nil {
+			recorder.Capture(vm.Pixels)
+		}
+		if avi != nil {
+			if err := avi.WriteFrame(vm.Pixels, samples); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *sequence != "" {
+			writeFile(fmt.Sprintf(*sequence, i), func(w io.Writer) error {
+				return capture.WritePNG(w, vm.Pixels, opts)
+			})
+		}
+	}
+
+	if *screenshot != "" {
+		writeFile(*screenshot, func(w io.Writer) error {
+			return capture.WritePNG(w, vm.Pixels, opts)
+		})
+	}
+	if recorder != nil {
+		writeFile(*gifFile, recorder.WriteGIF)
+	}
+	if avi != nil {
+		if err := avi.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *wavFile != "" {
+		writeFile(*wavFile, func(w io.Writer) error {
+			return capture.WriteWAV(w, sound)
+		})
+	}
+}
+
+func writeFile(name string, write func(w io.Writer) error) {
+	f, err := os.Create(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,219 @@
+package chip8
+
+import (
+	"fmt"
+	"html"
+	"io"
+)
+
+// Coverage records how each byte of a loaded ROM has been used while the
+// program runs: executed as an instruction, read as data, or never touched.
+type Coverage struct {
+	start uint16
+	execs []uint32 // number of times an instruction starting at an address was executed
+	reads []uint32 // number of times a byte was read as data
+}
+
+func NewCoverage(romSize int) *Coverage {
+	return &Coverage{
+		start: 0x200,
+		execs: make([]uint32, romSize),
+		reads: make([]uint32, romSize),
+	}
+}
+
+func (c *Coverage) index(addr uint16) (int, bool) {
+	if addr < c.start || int(addr-c.start) >= len(c.execs) {
+		return 0, false
+	}
+	return int(addr - c.start), true
+}
+
+func (c *Coverage) markExecuted(addr uint16) {
+	if i, ok := c.index(addr); ok {
+		c.execs[i]++
+	}
+}
+
+func (c *Coverage) markRead(addr uint16, n int) {
+	for j := 0; j < n; j++ {
+		if i, ok := c.index(addr + uint16(j)); ok {
+			c.reads[i]++
+		}
+	}
+}
+
+// Executed returns the number of times the instruction at addr was executed.
+func (c *Coverage) Executed(addr uint16) uint32 {
+	i, ok := c.index(addr)
+	if !ok {
+		return 0
+	}
+	return c.execs[i]
+}
+
+// Read returns the number of times the byte at addr was read as data.
+func (c *Coverage) Read(addr uint16) uint32 {
+	i, ok := c.index(addr)
+	if !ok {
+		return 0
+	}
+	return c.reads[i]
+}
+
+type CoverageKind int
+
+const (
+	Untouched CoverageKind = iota
+	Executed
+	ReadAsData
+)
+
+func (k CoverageKind) String() string {
+	switch k {
+	case Executed:
+		return "executed"
+	case ReadAsData:
+		return "data"
+	default:
+		return "untouched"
+	}
+}
+
+// A CoverageLine is a single line of the annotated disassembly; executed
+// instructions span two bytes, anything else is listed byte by byte.
+type CoverageLine struct {
+	Addr     uint16
+	Bytes    []byte
+	Kind     CoverageKind
+	Hits     uint32
+	Assembly string
+}
+
+// Lines walks the ROM in mem and annotates it with the coverage data.
+func (c *Coverage) Lines(mem []byte) []CoverageLine {
+	lines := []CoverageLine{}
+	end := c.start + uint16(len(c.execs))
+	for addr := c.start; addr < end; {
+		i := int(addr - c.start)
+		if c.execs[i] > 0 && addr+1 < end {
+			b1, b2 := mem[addr], mem[addr+1]
+			inst, err := getInstruction(b1, b2)
+			if err == nil {
+				lines = append(lines, CoverageLine{
+					Addr:     addr,
+					Bytes:    []byte{b1, b2},
+					Kind:     Executed,
+					Hits:     c.execs[i],
+					Assembly: inst.assembly,
+				})
+				addr += 2
+				continue
+			}
+		}
+
+		line := CoverageLine{
+			Addr:     addr,
+			Bytes:    []byte{mem[addr]},
+			Assembly: Sprintf("%-4v %-3x", "DB", mem[addr]),
+		}
+		switch {
+		case c.execs[i] > 0: // an invalid instruction, whose second byte was not executed
+			line.Kind = Executed
+			line.Hits = c.execs[i]
+		case c.reads[i] > 0:
+			line.Kind = ReadAsData
+			line.Hits = c.reads[i]
+		}
+		lines = append(lines, line)
+		addr++
+	}
+	return lines
+}
+
+// Summary returns the number of ROM bytes executed, read as data and never
+// touched, as shown by Lines: the second byte of an instruction only counts
+// as executed if the instruction is valid.
+func (c *Coverage) Summary(mem []byte) (executed, read, untouched int) {
+	for _, line := range c.Lines(mem) {
+		switch line.Kind {
+		case Executed:
+			executed += len(line.Bytes)
+		case ReadAsData:
+			read += len(line.Bytes)
+		default:
+			untouched += len(line.Bytes)
+		}
+	}
+	return executed, read, untouched
+}
+
+// WriteLCOV writes the coverage in the LCOV tracefile format. Since a ROM
+// has no source lines, ROM addresses are used as line numbers.
+func (c *Coverage) WriteLCOV(w io.Writer, mem []byte, romName string) error {
+	lines := c.Lines(mem)
+	hit := 0
+	if _, err := fmt.Fprintf(w, "TN:\nSF:%s\n", romName); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if line.Kind != Untouched {
+			hit++
+		}
+		if _, err := fmt.Fprintf(w, "DA:%d,%d\n", line.Addr, line.Hits); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	return err
+}
+
+// WriteHTML writes a standalone HTML page showing the annotated disassembly.
+func (c *Coverage) WriteHTML(w io.Writer, mem []byte, romName string) error {
+	executed, read, untouched := c.Summary(mem)
+	total := executed + read + untouched
+	percent := func(n int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(total)
+	}
+
+	_, err := fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage: %[1]s</title>
+<style>
+body { font-family: monospace; font-size: 13px; }
+td { padding: 0 8px; white-space: pre; }
+.executed { background: #c8f0c8; }
+.data { background: #c8d8f0; }
+.untouched { background: #f0c8c8; }
+</style>
+</head>
+<body>
+<h1>%[1]s</h1>
+<p>
+<span class="executed">executed: %[2]d (%.1[3]f%%)</span>
+<span class="data">data: %[4]d (%.1[5]f%%)</span>
+<span class="untouched">untouched: %[6]d (%.1[7]f%%)</span>
+</p>
+<table>
+<tr><th>Addr</th><th>Bytes</th><th>Hits</th><th>Instruction</th></tr>
+`, html.EscapeString(romName), executed, percent(executed), read, percent(read), untouched, percent(untouched))
+	if err != nil {
+		return err
+	}
+
+	for _, line := range c.Lines(mem) {
+		_, err := fmt.Fprintf(w, "<tr class=\"%s\"><td>%03x</td><td>% x</td><td>%d</td><td>%s</td></tr>\n",
+			line.Kind, line.Addr, line.Bytes, line.Hits, html.EscapeString(line.Assembly))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "</table>\n</body>\n</html>\n")
+	return err
+}
@@ -0,0 +1,62 @@
+package chip8
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	rom := []byte{
+		0xA2, 0x08, // LD I, 208
+		0xD0, 0x02, // DRW V0, V0, 2
+		0xF1, 0x65, // LD V1, [I]
+		0x12, 0x06, // JP 206
+		0xFF, 0x81, // sprite data
+		0x00, 0x00, // never touched
+	}
+
+	vm, _ := NewVm(rom, testIO)
+	vm.Coverage = NewCoverage(len(rom))
+	vm.Halt.Policy = HaltContinue // keep running the self-jump
+	vm.Run(RunParams{InstCount: 5, FrameDuration: 1})
+
+	if vm.Coverage.Executed(0x200) != 1 || vm.Coverage.Executed(0x206) != 2 {
+		t.Errorf("Coverage err; executions: %d, %d", vm.Coverage.Executed(0x200), vm.Coverage.Executed(0x206))
+	}
+	if vm.Coverage.Read(0x208) != 2 || vm.Coverage.Read(0x209) != 2 {
+		t.Errorf("Coverage err; reads: %d, %d", vm.Coverage.Read(0x208), vm.Coverage.Read(0x209))
+	}
+
+	executed, read, untouched := vm.Coverage.Summary(vm.Mem)
+	if executed != 8 || read != 2 || untouched != 2 {
+		t.Errorf("Coverage summary err; executed: %d, read: %d, untouched: %d", executed, read, untouched)
+	}
+
+	var lcov strings.Builder
+	vm.Coverage.WriteLCOV(&lcov, vm.Mem, "test.ch8")
+	if !strings.Contains(lcov.String(), "DA:518,2\n") || !strings.Contains(lcov.String(), "LF:8\nLH:6\n") {
+		t.Errorf("Coverage LCOV err; %s", lcov.String())
+	}
+}
+
+func TestCoverageInvalid(t *testing.T) {
+	rom := []byte{
+		0x50, 0x01, // invalid
+		0x00, 0x00, // never touched
+	}
+	vm, _ := NewVm(rom, testIO)
+	vm.Coverage = NewCoverage(len(rom))
+	if err := vm.Run(RunParams{InstCount: 1, FrameDuration: 1}); err == nil {
+		t.Fatal("Coverage err; invalid instruction run")
+	}
+
+	// the invalid instruction is shown as an executed byte followed by data
+	lines := vm.Coverage.Lines(vm.Mem)
+	if len(lines) != 4 || lines[0].Kind != Executed || lines[1].Kind != Untouched {
+		t.Errorf("Coverage lines err; %+v", lines)
+	}
+	executed, read, untouched := vm.Coverage.Summary(vm.Mem)
+	if executed != 1 || read != 0 || untouched != 3 {
+		t.Errorf("Coverage summary err; executed: %d, read: %d, untouched: %d", executed, read, untouched)
+	}
+}
@@ -0,0 +1,168 @@
+// Package gym runs ROMs as reinforcement-learning environments in the manner
+// of OpenAI Gym: an agent observes the display, picks the keys to hold and is
+// rewarded by the increase of a score read from the memory of the VM. The VM
+// runs headless and as fast as possible, and episodes are deterministic for a
+// seed.
+package gym
+
+import (
+	"math/rand"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/loader"
+)
+
+// A KeySet is the set of keys held during a step, key k being bit k; the 65536
+// key sets can serve as the discrete actions of an agent.
+type KeySet uint16
+
+// Keys returns a key set holding keys.
+func Keys(keys ...byte) KeySet {
+	var k KeySet
+	for _, key := range keys {
+		k |= 1 << (key & 0xF)
+	}
+	return k
+}
+
+func (k KeySet) pressed() [16]bool {
+	keys := [16]bool{}
+	for key := range keys {
+		keys[key] = k&(1<<key) != 0
+	}
+	return keys
+}
+
+// A Score reads the score of a game from the VM.
+type Score func(vm *chip8.Vm) int
+
+// BCDScore reads a score stored as decimal digits, one per byte from the most
+// significant one, as written by Fx33.
+func BCDScore(addr uint16, digits int) Score {
+	return func(vm *chip8.Vm) int {
+		score := 0
+		for i := 0; i < digits; i++ {
+			score = score*10 + int(vm.Mem[int(addr)+i]%10)
+		}
+		return score
+	}
+}
+
+// ByteScore reads a score stored in a byte of memory.
+func ByteScore(addr uint16) Score {
+	return func(vm *chip8.Vm) int {
+		return int(vm.Mem[addr])
+	}
+}
+
+// RegisterScore reads a score kept in a register.
+func RegisterScore(x byte) Score {
+	return func(vm *chip8.Vm) int {
+		return int(vm.Regs[x&0xF])
+	}
+}
+
+type Options struct {
+	Score     Score                   // rewards are the changes of the score; there are none without it
+	GameOver  func(vm *chip8.Vm) bool // ends episodes, e.g. when no life is left
+	FrameSkip int                     // the number of frames a step runs with the same action; defaults to 4
+	// StickyActions is the probability that the previous action is held again
+	// for a frame instead of the action of the step, which keeps agents from
+	// learning sequences of actions by heart.
+	StickyActions float64
+	MaxFrames     int   // the number of frames after which episodes are cut off; unlimited if 0
+	InstCount     int   // the number of instructions per frame; defaults to the ROM's recommended tickrate
+	Seed          int64 // seeds the random numbers of the VMs and of the sticky actions
+}
+
+// Env is an environment playing a ROM. Episodes end when the program is
+// over, as detected by the halt policy HaltStop, when the game is over or
+// when they are cut off.
+type Env struct {
+	rom    loader.Rom
+	opts   Options
+	rand   *rand.Rand // seeds episodes and draws sticky actions
+	io     *chip8.HeadlessIO
+	vm     chip8.Vm
+	params chip8.RunParams
+	score  int
+	frames int
+	action KeySet // the action held in the last frame
+	err    error
+}
+
+func New(rom loader.Rom, opts Options) *Env {
+	if opts.FrameSkip <= 0 {
+		opts.FrameSkip = 4
+	}
+	return &Env{
+		rom:  rom,
+		opts: opts,
+		rand: rand.New(rand.NewSource(opts.Seed)),
+		io:   &chip8.HeadlessIO{},
+	}
+}
+
+// Reset starts a new episode and returns its first observation. Each episode
+// runs with its own seed, drawn from the seed of the environment.
+func (e *Env) Reset() chip8.Pixels {
+	e.io.Keys = [16]bool{}
+	e.score, e.frames, e.action = 0, 0, 0
+	if e.vm, e.params, e.err = e.rom.Boot(e.io); e.err != nil {
+		return e.vm.Pixels // the episode is over before it started
+	}
+	e.vm.Seed(e.rand.Int63())
+	e.vm.Halt.Policy = chip8.HaltStop
+	if e.opts.InstCount != 0 {
+		e.params.InstCount = e.opts.InstCount
+	}
+	if e.opts.Score != nil {
+		e.score = e.opts.Score(&e.vm)
+	}
+	return e.vm.Pixels
+}
+
+// Step holds the keys of an action for the frames of a step and returns the
+// display, the change of the score and whether the episode is over.
+func (e *Env) Step(action KeySet) (obs chip8.Pixels, reward float64, done bool) {
+	if e.err != nil { // the episode is over, and the ROM may not even have booted
+		return e.vm.Pixels, 0, true
+	}
+	for i := 0; i < e.opts.FrameSkip && !e.done(); i++ {
+		if e.opts.StickyActions == 0 || e.rand.Float64() >= e.opts.StickyActions {
+			e.action = action
+		}
+		e.io.Keys = e.action.pressed()
+		if e.err = e.vm.RunFrame(e.params); e.err != nil {
+			break
+		}
+		e.frames++
+	}
+	if e.opts.Score != nil {
+		score := e.opts.Score(&e.vm)
+		reward = float64(score - e.score)
+		e.score = score
+	}
+	return e.vm.Pixels, reward, e.done()
+}
+
+func (e *Env) done() bool {
+	return e.err != nil || e.vm.Done ||
+		(e.opts.MaxFrames > 0 && e.frames >= e.opts.MaxFrames) ||
+		(e.opts.GameOver != nil && e.opts.GameOver(&e.vm))
+}
+
+// Err returns the error that ended the episode, if the program failed.
+func (e *Env) Err() error {
+	return e.err
+}
+
+// Frames returns the number of frames run in the episode.
+func (e *Env) Frames() int {
+	return e.frames
+}
+
+// Vm returns the VM of the episode, e.g. to read more than the display.
+func (e *Env) Vm() *chip8.Vm {
+	return &e.vm
+}
@@ -0,0 +1,92 @@
+package gym
+
+import (
+	"testing"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/loader"
+)
+
+// counts the frames key 5 is held in a BCD score at 300
+var counter = []byte{
+	0x65, 0x00, // LD V5, 0
+	0x61, 0x05, // LD V1, 5
+	0xA3, 0x00, // LD I, 300
+	0xE1, 0xA1, // SKNP V1
+	0x75, 0x01, // ADD V5, 1
+	0xF5, 0x33, // LD B, V5
+	0x12, 0x06, // JP 206
+}
+
+func newEnv(t *testing.T, opts Options) *Env {
+	rom, err := loader.Load("counter.ch8", counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.InstCount = 4
+	opts.Score = BCDScore(0x300, 3)
+	return New(rom, opts)
+}
+
+func TestStep(t *testing.T) {
+	env := newEnv(t, Options{FrameSkip: 2, MaxFrames: 10})
+	env.Reset()
+	env.Step(0)
+	if _, reward, done := env.Step(0); reward != 0 || done {
+		t.Errorf("Step err; reward %v without key, done %v", reward, done)
+	}
+	// a key held in a frame is tested at its end and counted in the next one
+	if _, reward, _ := env.Step(Keys(5)); reward != 1 {
+		t.Errorf("Step err; reward %v for the first frames", reward)
+	}
+	if _, reward, _ := env.Step(Keys(5)); reward != 2 {
+		t.Errorf("Step err; reward %v for 2 frames", reward)
+	}
+	if _, reward, done := env.Step(Keys(5, 1)); reward != 2 || !done || env.Frames() != 10 {
+		t.Errorf("Step err; reward %v, done %v after %d frames", reward, done, env.Frames())
+	}
+
+	env.Reset()
+	if env.Frames() != 0 || env.Vm().Mem[0x302] != 0 {
+		t.Errorf("Reset err; frames %d, score %d", env.Frames(), env.Vm().Mem[0x302])
+	}
+}
+
+func TestBootError(t *testing.T) {
+	rom, err := loader.Load("huge.ch8", make([]byte, 0x1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := New(rom, Options{Score: BCDScore(0x300, 3), GameOver: func(vm *chip8.Vm) bool { return vm.Mem[0x300] != 0 }})
+	env.Reset()
+	if _, reward, done := env.Step(Keys(5)); env.Err() == nil || reward != 0 || !done {
+		t.Errorf("Boot err; %v, reward %v, done %v", env.Err(), reward, done)
+	}
+}
+
+func TestDeterminism(t *testing.T) {
+	play := func() []float64 {
+		env := newEnv(t, Options{StickyActions: 0.5, Seed: 7})
+		rewards := []float64{}
+		for episode := 0; episode < 2; episode++ {
+			env.Reset()
+			for i := 0; i < 20; i++ {
+				_, reward, _ := env.Step(KeySet(i%2) << 5)
+				rewards = append(rewards, reward)
+			}
+		}
+		return rewards
+	}
+	first, second := play(), play()
+	total := 0.0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Determinism err; step %d rewarded %v and %v", i, first[i], second[i])
+		}
+		total += first[i]
+	}
+	// sticky actions make the key held for more or less than half the frames
+	if total == 80 {
+		t.Errorf("Determinism err; actions are not sticky")
+	}
+}
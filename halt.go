@@ -0,0 +1,106 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// HaltReason tells why a program is considered to be over.
+type HaltReason int
+
+const (
+	NotHalted      HaltReason = iota
+	HaltSelfJump              // a 1nnn jumped to itself, which nothing can break out of
+	HaltExit                  // the program exited with 00FD
+	HaltNoProgress            // nothing changed for a number of frames and no key was read
+)
+
+func (r HaltReason) String() string {
+	switch r {
+	case HaltSelfJump:
+		return "self-jump"
+	case HaltExit:
+		return "exit"
+	case HaltNoProgress:
+		return "no progress"
+	default:
+		return "running"
+	}
+}
+
+// HaltPolicy is what the VM does when it detects that a program is over.
+type HaltPolicy int
+
+const (
+	HaltStop     HaltPolicy = iota // set Done and stop executing instructions
+	HaltNotify                     // set Halted but keep running
+	HaltContinue                   // ignore it
+)
+
+// HaltPolicies are the halt policies by name.
+var HaltPolicies = map[string]HaltPolicy{
+	"stop":     HaltStop,
+	"notify":   HaltNotify,
+	"continue": HaltContinue,
+}
+
+// HaltConfig configures the detection of the end of programs.
+type HaltConfig struct {
+	Policy HaltPolicy
+	// NoProgressFrames is the number of frames without any change to the
+	// memory, registers, timers or display after which a program that does not
+	// read keys is considered over; zero disables this detection.
+	NoProgressFrames int
+}
+
+// DefaultHalt stops programs that are over or have not progressed for five
+// seconds.
+var DefaultHalt = HaltConfig{Policy: HaltStop, NoProgressFrames: 300}
+
+// halt applies the halt policy for a reason. A program jumping to itself
+// while the buzzer sounds is only stopped once the sound timer has run out, as
+// programs end by waiting for their last sound; the self-jump runs again each
+// frame until then.
+func (vm *Vm) halt(reason HaltReason) {
+	if vm.Halt.Policy == HaltContinue {
+		return
+	}
+	vm.Halted = reason
+	if vm.Halt.Policy == HaltStop && (reason != HaltSelfJump || vm.ST == 0) {
+		vm.Done = true
+	}
+}
+
+// checkProgress is called at the end of each frame to detect programs that
+// loop without changing anything. Programs reading keys are waiting for the
+// player rather than stuck.
+func (vm *Vm) checkProgress() {
+	if vm.Halt.NoProgressFrames <= 0 || vm.Halted != NotHalted {
+		return
+	}
+	state := vm.stateHash()
+	if vm.keysRead || state != vm.lastState {
+		vm.lastState = state
+		vm.stillFrames = 0
+		vm.keysRead = false
+		return
+	}
+	vm.stillFrames++
+	if vm.stillFrames >= vm.Halt.NoProgressFrames {
+		vm.halt(HaltNoProgress)
+	}
+}
+
+// stateHash fingerprints the state of the VM but for the program counter,
+// which changes from frame to frame within a loop.
+func (vm *Vm) stateHash() uint64 {
+	h := fnv.New64a()
+	h.Write(vm.Mem)
+	h.Write(vm.Regs[:])
+	binary.Write(h, binary.LittleEndian, vm.Stack)
+	h.Write([]byte{byte(vm.I >> 8), byte(vm.I), vm.Sp, vm.DT, vm.ST})
+	for _, row := range vm.Pixels {
+		h.Write(row[:])
+	}
+	return h.Sum64()
+}
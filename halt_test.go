@@ -0,0 +1,52 @@
+package chip8
+
+import "testing"
+
+func TestHalt(t *testing.T) {
+	tests := []struct {
+		name   string
+		rom    []byte
+		policy HaltPolicy
+		frames int
+		reason HaltReason
+		done   bool
+	}{
+		{"self-jump", []byte{0x60, 0x01, 0x12, 0x02}, HaltStop, 1, HaltSelfJump, true},
+		{"self-jump buzzing", []byte{0x60, 0x03, 0xF0, 0x18, 0x12, 0x04}, HaltStop, 3, HaltSelfJump, false},
+		{"self-jump buzzed", []byte{0x60, 0x03, 0xF0, 0x18, 0x12, 0x04}, HaltStop, 4, HaltSelfJump, true},
+		{"self-jump notified", []byte{0x12, 0x00}, HaltNotify, 1, HaltSelfJump, false},
+		{"self-jump ignored", []byte{0x12, 0x00}, HaltContinue, 1, NotHalted, false},
+		{"exit", []byte{0x00, 0xFD}, HaltStop, 1, HaltExit, true},
+		{"no progress", []byte{0x60, 0x01, 0x12, 0x00}, HaltStop, 5, HaltNoProgress, true},
+		{"still too short", []byte{0x60, 0x01, 0x12, 0x00}, HaltStop, 3, NotHalted, false},
+		{"waiting for keys", []byte{0xE0, 0x9E, 0x12, 0x00}, HaltStop, 10, NotHalted, false},
+		{"timer running", []byte{0x60, 0x10, 0xF0, 0x15, 0x61, 0x01, 0x12, 0x04}, HaltStop, 10, NotHalted, false},
+	}
+	for _, test := range tests {
+		vm, _ := NewVm(test.rom, &HeadlessIO{})
+		vm.Halt = HaltConfig{Policy: test.policy, NoProgressFrames: 4}
+		for i := 0; i < test.frames; i++ {
+			vm.RunFrame(RunParams{InstCount: 2})
+		}
+		if vm.Halted != test.reason || vm.Done != test.done {
+			t.Errorf("Halt err; %s: halted: %v, done: %v", test.name, vm.Halted, vm.Done)
+		}
+	}
+}
+
+// TestHaltBuzzing checks that the sound timer keeps counting down after a
+// self-jump until the buzzer stops.
+func TestHaltBuzzing(t *testing.T) {
+	// LD V0, 3; LD ST, V0; JP 204
+	vm, _ := NewVm([]byte{0x60, 0x03, 0xF0, 0x18, 0x12, 0x04}, &HeadlessIO{})
+	buzzed := 0
+	for i := 0; i < 10 && !vm.Done; i++ {
+		vm.RunFrame(RunParams{InstCount: 10})
+		if vm.Buzzing {
+			buzzed++
+		}
+	}
+	if !vm.Done || vm.ST != 0 || vm.Buzzing || buzzed != 3 {
+		t.Errorf("Halt err; done: %v, ST: %d, buzzed for %d frames", vm.Done, vm.ST, buzzed)
+	}
+}
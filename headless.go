@@ -0,0 +1,13 @@
+package chip8
+
+// HeadlessIO is an IO for VMs that are not displayed, e.g. when running
+// tests or exporting recordings; the keys pressed are set directly.
+type HeadlessIO struct {
+	Keys [16]bool
+}
+
+func (h *HeadlessIO) Draw(pixels Pixels, dirty Region) {}
+
+func (h *HeadlessIO) GetKeysPressed() [16]bool {
+	return h.Keys
+}
@@ -0,0 +1,116 @@
+package chip8
+
+// Hooks are the functions subscribed to the events of a VM, letting tracers,
+// profilers or debuggers observe the execution of a program. A VM without
+// subscriptions only pays for a nil check per event.
+type Hooks struct {
+	nextID      int
+	instruction []hook[func(vm *Vm, addr uint16, opcode uint16)]
+	memWrite    []hook[func(vm *Vm, addr uint16, value byte)]
+	draw        []hook[func(vm *Vm, sprite Sprite, x, y byte, collision bool)]
+	frame       []hook[func(vm *Vm)]
+	keyWait     []hook[func(vm *Vm, waiting bool)]
+
+	// Muted suspends the calls to the hooks, e.g. while running frames that
+	// may be run again.
+	Muted bool
+}
+
+// hooked reports whether the events of the VM are dispatched to hooks.
+func (vm *Vm) hooked() bool {
+	return vm.Hooks != nil && !vm.Hooks.Muted
+}
+
+type hook[F any] struct {
+	id int
+	fn F
+}
+
+// subscribe adds a function to a list of hooks and returns the function
+// removing it. Lists are copied on change so that a hook can unsubscribe
+// while the event is dispatched.
+func subscribe[F any](vm *Vm, list func(h *Hooks) *[]hook[F], fn F) func() {
+	if vm.Hooks == nil {
+		vm.Hooks = &Hooks{}
+	}
+	hooks := vm.Hooks
+	hooks.nextID++
+	id := hooks.nextID
+	l := list(hooks)
+	*l = append((*l)[:len(*l):len(*l)], hook[F]{id, fn})
+	return func() {
+		l := list(hooks)
+		kept := make([]hook[F], 0, len(*l))
+		for _, h := range *l {
+			if h.id != id {
+				kept = append(kept, h)
+			}
+		}
+		*l = kept
+	}
+}
+
+// OnInstruction subscribes to the execution of instructions; fn is called
+// with the address and the opcode of each instruction before it is executed.
+func (vm *Vm) OnInstruction(fn func(vm *Vm, addr uint16, opcode uint16)) (unsubscribe func()) {
+	return subscribe(vm, func(h *Hooks) *[]hook[func(*Vm, uint16, uint16)] { return &h.instruction }, fn)
+}
+
+// OnMemWrite subscribes to the bytes the program writes to memory with Fx33
+// and Fx55.
+func (vm *Vm) OnMemWrite(fn func(vm *Vm, addr uint16, value byte)) (unsubscribe func()) {
+	return subscribe(vm, func(h *Hooks) *[]hook[func(*Vm, uint16, byte)] { return &h.memWrite }, fn)
+}
+
+// OnDraw subscribes to the sprites drawn by Dxyn, with the coordinates they
+// are drawn at and whether they collided with lit pixels.
+func (vm *Vm) OnDraw(fn func(vm *Vm, sprite Sprite, x, y byte, collision bool)) (unsubscribe func()) {
+	return subscribe(vm, func(h *Hooks) *[]hook[func(*Vm, Sprite, byte, byte, bool)] { return &h.draw }, fn)
+}
+
+// OnFrame subscribes to the end of frames, once the display has been
+// presented and the timers decremented.
+func (vm *Vm) OnFrame(fn func(vm *Vm)) (unsubscribe func()) {
+	return subscribe(vm, func(h *Hooks) *[]hook[func(*Vm)] { return &h.frame }, fn)
+}
+
+// OnKeyWait subscribes to the waits of Fx0A: fn is called when the program
+// starts waiting for a key and when the wait is over, the key then being in
+// the register KeyWaitReg.
+func (vm *Vm) OnKeyWait(fn func(vm *Vm, waiting bool)) (unsubscribe func()) {
+	return subscribe(vm, func(h *Hooks) *[]hook[func(*Vm, bool)] { return &h.keyWait }, fn)
+}
+
+func (vm *Vm) emitInstruction(addr uint16, opcode uint16) {
+	for _, h := range vm.Hooks.instruction {
+		h.fn(vm, addr, opcode)
+	}
+}
+
+// writeMem writes a byte of memory on behalf of the program.
+func (vm *Vm) writeMem(addr uint16, value byte) {
+	vm.Mem[addr] = value
+	if vm.hooked() {
+		for _, h := range vm.Hooks.memWrite {
+			h.fn(vm, addr, value)
+		}
+	}
+}
+
+func (vm *Vm) emitDraw(sprite Sprite, x, y byte, collision bool) {
+	for _, h := range vm.Hooks.draw {
+		h.fn(vm, sprite, x, y, collision)
+	}
+}
+
+func (vm *Vm) emitFrame() {
+	for _, h := range vm.Hooks.frame {
+		h.fn(vm)
+	}
+}
+
+func (vm *Vm) emitKeyWait(waiting bool) {
+	for _, h := range vm.Hooks.keyWait {
+		h.fn(vm, waiting)
+	}
+}
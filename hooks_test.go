@@ -0,0 +1,73 @@
+package chip8
+
+import "testing"
+
+func TestHooks(t *testing.T) {
+	rom := []byte{
+		0x60, 0x7B, // LD V0, 7B
+		0xA3, 0x00, // LD I, 300
+		0xF0, 0x33, // LD B, V0
+		0xD0, 0x01, // DRW V0, V0, 1
+		0xF1, 0x0A, // LD V1, K
+	}
+	io := &HeadlessIO{}
+	vm, _ := NewVm(rom, io)
+
+	addrs := []uint16{}
+	writes := map[uint16]byte{}
+	draws, frames, waits := 0, 0, []bool{}
+	vm.OnInstruction(func(vm *Vm, addr uint16, opcode uint16) {
+		addrs = append(addrs, addr)
+		if addr == 0x200 && opcode != 0x607B {
+			t.Errorf("Hooks err; opcode: %x", opcode)
+		}
+	})
+	vm.OnMemWrite(func(vm *Vm, addr uint16, value byte) { writes[addr] = value })
+	vm.OnDraw(func(vm *Vm, sprite Sprite, x, y byte, collision bool) {
+		draws++
+		if sprite != (Sprite{Addr: 0x300, Height: 1}) || x != 0x7B%64 || y != 0x7B%32 || collision {
+			t.Errorf("Hooks err; draw of %+v at %d, %d", sprite, x, y)
+		}
+	})
+	unsubscribe := vm.OnFrame(func(vm *Vm) { frames++ })
+	vm.OnKeyWait(func(vm *Vm, waiting bool) { waits = append(waits, waiting) })
+
+	vm.RunFrame(RunParams{InstCount: 5})
+	if len(addrs) != 5 || addrs[4] != 0x208 {
+		t.Errorf("Hooks err; instructions: %x", addrs)
+	}
+	if len(writes) != 3 || writes[0x300] != 1 || writes[0x301] != 2 || writes[0x302] != 3 {
+		t.Errorf("Hooks err; memory writes: %v", writes)
+	}
+	if draws != 1 || frames != 1 {
+		t.Errorf("Hooks err; draws: %d, frames: %d", draws, frames)
+	}
+
+	unsubscribe()
+	io.Keys[4] = true
+	vm.RunFrame(RunParams{InstCount: 1})
+	io.Keys[4] = false
+	vm.RunFrame(RunParams{InstCount: 1})
+	if frames != 1 {
+		t.Errorf("Hooks err; frame hook called after unsubscribing")
+	}
+	if len(waits) != 2 || !waits[0] || waits[1] || vm.Regs[1] != 4 {
+		t.Errorf("Hooks err; key waits: %v", waits)
+	}
+}
+
+func TestMutedHooks(t *testing.T) {
+	vm, _ := NewVm([]byte{0x12, 0x00}, &HeadlessIO{})
+	vm.Halt.Policy = HaltContinue
+	instructions, frames := 0, 0
+	vm.OnInstruction(func(vm *Vm, addr uint16, opcode uint16) { instructions++ })
+	vm.OnFrame(func(vm *Vm) { frames++ })
+
+	vm.Hooks.Muted = true
+	vm.RunFrame(RunParams{InstCount: 3})
+	vm.Hooks.Muted = false
+	vm.RunFrame(RunParams{InstCount: 3})
+	if instructions != 3 || frames != 1 {
+		t.Errorf("Muted hooks err; instructions: %d, frames: %d", instructions, frames)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package chip8
 
 import (
 	"errors"
@@ -31,7 +31,7 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 		case 0xE0:
 			return newInst("CLS", func(vm *Vm) {
 				vm.Pixels = Pixels{}
-				vm.IO.ClearScreen()
+				vm.markDirty(FullScreen)
 			}), nil
 		case 0xEE:
 			return newInst("RET", func(vm *Vm) {
@@ -39,6 +39,11 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 				vm.Pc = vm.Stack[vm.Sp]
 				vm.incPc()
 			}), nil
+		case 0xFD:
+			return newInst("EXIT", func(vm *Vm) {
+				vm.halt(HaltExit)
+				vm.Pc -= 2 // stay on the exit when the program keeps running
+			}), nil
 		default:
 			return newInst("Ignored", func(vm *Vm) {
 				fmt.Println("Ignoring instruction")
@@ -46,13 +51,9 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 		}
 	case 0x1:
 		return newInst(Sprintf("%-4v %-3x", "JP", addr), func(vm *Vm) {
-			// Check to see if the VM is jumping to the same address over and over.
-			// If it is then the program is probably done.
+			// Nothing can break a jump to the same address; the program is done.
 			if vm.Pc-2 == addr {
-				if vm.repeatCnt == 10 {
-					vm.Done = true
-				}
-				vm.repeatCnt++
+				vm.halt(HaltSelfJump)
 			}
 
 			vm.Pc = addr
@@ -97,17 +98,23 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 		case 0x1:
 			return newInst(Sprintf("%-4v V%-2x V%-2x", "OR", x, y), func(vm *Vm) {
 				vm.Regs[x] = vm.Regs[x] | vm.Regs[y]
-				vm.Regs[0xF] = 0
+				if vm.Quirks.VFReset {
+					vm.Regs[0xF] = 0
+				}
 			}), nil
 		case 0x2:
 			return newInst(Sprintf("%-4v V%-2x V%-2x", "AND", x, y), func(vm *Vm) {
 				vm.Regs[x] = vm.Regs[x] & vm.Regs[y]
-				vm.Regs[0xF] = 0
+				if vm.Quirks.VFReset {
+					vm.Regs[0xF] = 0
+				}
 			}), nil
 		case 0x3:
 			return newInst(Sprintf("%-4v V%-2x V%-2x", "XOR", x, y), func(vm *Vm) {
 				vm.Regs[x] = vm.Regs[x] ^ vm.Regs[y]
-				vm.Regs[0xF] = 0
+				if vm.Quirks.VFReset {
+					vm.Regs[0xF] = 0
+				}
 			}), nil
 		case 0x4:
 			return newInst(Sprintf("%-4v V%-2x V%-2x", "ADD", x, y), func(vm *Vm) {
@@ -123,7 +130,9 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 			}), nil
 		case 0x6:
 			return newInst(Sprintf("%-4v V%-2x", "SHR", x), func(vm *Vm) {
-				vm.Regs[x] = vm.Regs[y]
+				if !vm.Quirks.Shifting {
+					vm.Regs[x] = vm.Regs[y]
+				}
 				bit := vm.Regs[x] & 1
 				vm.Regs[x] = vm.Regs[x] >> 1
 				vm.setVF1If(bit == 1)
@@ -136,7 +145,9 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 			}), nil
 		case 0xE:
 			return newInst(Sprintf("%-4v V%-2x", "SHL", x), func(vm *Vm) {
-				vm.Regs[x] = vm.Regs[y]
+				if !vm.Quirks.Shifting {
+					vm.Regs[x] = vm.Regs[y]
+				}
 				bit := vm.Regs[x] & 0x80
 				vm.Regs[x] = vm.Regs[x] << 1
 				vm.setVF1If(bit == 0x80)
@@ -157,17 +168,30 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 		}), nil
 	case 0xB:
 		return newInst(Sprintf("%-4v %-3v %-3x", "JP", "V0", addr), func(vm *Vm) {
-			vm.Pc = addr + uint16(vm.Regs[0])
+			if vm.Quirks.Jumping {
+				vm.Pc = addr + uint16(vm.Regs[x])
+			} else {
+				vm.Pc = addr + uint16(vm.Regs[0])
+			}
 		}), nil
 	case 0xC:
 		return newInst(Sprintf("%-4v V%-2x %-3x", "RND", x, byte2), func(vm *Vm) {
-			randomByte := byte(rand.Intn(255))
+			var randomByte byte
+			if vm.Rand != nil {
+				randomByte = byte(vm.Rand.Intn(256))
+			} else {
+				randomByte = byte(rand.Intn(256))
+			}
 			vm.Regs[x] = randomByte & byte2
 		}), nil
 	case 0xD:
 		n := byte2 & 0xF
 		return newInst(Sprintf("%-4v V%-2x V%-2x %-3x", "DRW", x, y, n), func(vm *Vm) {
 			spriteGroup := vm.Mem[vm.I : vm.I+uint16(n)]
+			vm.LastSprite = Sprite{Addr: vm.I, Height: int(n)}
+			if vm.Coverage != nil {
+				vm.Coverage.markRead(vm.I, int(n))
+			}
 			xStart := int(vm.Regs[x] % 64)
 			yStart := int(vm.Regs[y] % 32)
 			vm.Regs[0xF] = 0
@@ -176,12 +200,17 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 				for xOffset := 0; xOffset < 8; xOffset++ {
 					col := xStart + xOffset
 					if col > 63 || row > 31 {
-						continue
+						if vm.Quirks.Clipping {
+							continue
+						}
+						col %= 64
+						row %= 32
 					}
 					pixel := &vm.Pixels[row][col]
 
 					// check if the current bit in the sprite is to be drawn
 					if sprite&0x80 > 1 {
+						vm.markDirty(Region{X: col, Y: row, W: 1, H: 1})
 						// check if pixel has already been drawn on
 						if *pixel == 1 {
 							*pixel = 0
@@ -193,18 +222,22 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 					sprite <<= 1
 				}
 			}
-			vm.IO.Draw(vm.Pixels)
+			if vm.hooked() {
+				vm.emitDraw(vm.LastSprite, byte(xStart), byte(yStart), vm.Regs[0xF] == 1)
+			}
 		}), nil
 	case 0xE:
 		switch byte2 {
 		case 0x9E:
 			return newInst(Sprintf("%-4v V%-2x", "SKP", x), func(vm *Vm) {
 				vm.Keys = vm.IO.GetKeysPressed()
+				vm.keysRead = true
 				vm.skipIf(vm.Keys[vm.Regs[x]])
 			}), nil
 		case 0xA1:
 			return newInst(Sprintf("%-4v V%-2x", "SKNP", x), func(vm *Vm) {
 				vm.Keys = vm.IO.GetKeysPressed()
+				vm.keysRead = true
 				vm.skipIf(!vm.Keys[vm.Regs[x]])
 			}), nil
 		default:
@@ -218,11 +251,12 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 			}), nil
 		case 0x0A:
 			return newInst(Sprintf("%-4v V%-2x %-3v", "LD", x, "K"), func(vm *Vm) {
-				key, pressed := vm.IO.WaitKeyPress()
-				if !pressed {
-					vm.Pc -= 2 // decrement to return to this same instruction after
-				} else {
-					vm.Regs[x] = key
+				// the key is stored once released, see RunFrame
+				vm.WaitingForKey = true
+				vm.KeyWaitReg = x
+				vm.keysDown = [16]bool{}
+				if vm.hooked() {
+					vm.emitKeyWait(true)
 				}
 			}), nil
 		case 0x15:
@@ -246,24 +280,31 @@ func getInstruction(byte1, byte2 byte) (Instruction, error) {
 		case 0x33:
 			return newInst(Sprintf("%-4v %-3v V%-2x", "LD", "B", x), func(vm *Vm) {
 				num := vm.Regs[x]
-				vm.Mem[vm.I+2] = num % 10 // ones place
+				vm.writeMem(vm.I+2, num%10) // ones place
 				num /= 10
-				vm.Mem[vm.I+1] = num % 10 // tens place
+				vm.writeMem(vm.I+1, num%10) // tens place
 				num /= 10
-				vm.Mem[vm.I] = num % 10 // hundreds place
+				vm.writeMem(vm.I, num%10) // hundreds place
 			}), nil
 		case 0x55:
 			return newInst(Sprintf("%-4v %-3v V%-2x", "LD", "[I]", x), func(vm *Vm) {
 				for i := 0; i <= int(x); i++ {
-					vm.Mem[vm.I] = vm.Regs[i]
-					vm.I++
+					vm.writeMem(vm.I+uint16(i), vm.Regs[i])
+				}
+				if vm.Quirks.Memory {
+					vm.I += uint16(x) + 1
 				}
 			}), nil
 		case 0x65:
 			return newInst(Sprintf("%-4v V%-2x %-3v", "LD", x, "[I]"), func(vm *Vm) {
+				if vm.Coverage != nil {
+					vm.Coverage.markRead(vm.I, int(x)+1)
+				}
 				for i := 0; i <= int(x); i++ {
-					vm.Regs[i] = vm.Mem[vm.I]
-					vm.I++
+					vm.Regs[i] = vm.Mem[vm.I+uint16(i)]
+				}
+				if vm.Quirks.Memory {
+					vm.I += uint16(x) + 1
 				}
 			}), nil
 		default:
@@ -0,0 +1,194 @@
+// Package keymap maps the inputs of a host, keyboard keys and gamepad
+// buttons, onto the 16 keys of the CHIP-8 keypad.
+//
+// Keyboard inputs are named after the `KeyboardEvent.code` of the key, e.g.
+// `KeyQ` or `ArrowUp`, which identifies a physical key whatever the layout of
+// the keyboard. Gamepad inputs are named after the index of a button of the
+// standard gamepad mapping, e.g. `Button12`, or the index and direction of an
+// axis, e.g. `Axis0-`.
+package keymap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+// A Keymap maps inputs to keypad keys; several inputs may map to the same key.
+type Keymap map[string]byte
+
+// keyboard lays the keypad out over the left of the keyboard:
+//
+//	1 2 3 C      1 2 3 4
+//	4 5 6 D  ->  Q W E R
+//	7 8 9 E      A S D F
+//	A 0 B F      Z X C V
+var keyboard = Keymap{
+	"Digit1": 0x1, "Digit2": 0x2, "Digit3": 0x3, "Digit4": 0xC,
+	"KeyQ": 0x4, "KeyW": 0x5, "KeyE": 0x6, "KeyR": 0xD,
+	"KeyA": 0x7, "KeyS": 0x8, "KeyD": 0x9, "KeyF": 0xE,
+	"KeyZ": 0xA, "KeyX": 0x0, "KeyC": 0xB, "KeyV": 0xF,
+}
+
+// directions are the inputs of the directions of the keyboard and gamepad.
+var directions = map[string][]string{
+	"up":    {"ArrowUp", "Button12", "Axis1-"},
+	"down":  {"ArrowDown", "Button13", "Axis1+"},
+	"left":  {"ArrowLeft", "Button14", "Axis0-"},
+	"right": {"ArrowRight", "Button15", "Axis0+"},
+	"a":     {"Space", "Button0"},
+	"b":     {"Button1"},
+}
+
+// defaultActions are the keys most programs use for actions: the W, A, S and
+// D keys of the keyboard layout for directions and E for firing.
+var defaultActions = map[string]byte{
+	"up": 0x5, "down": 0x8, "left": 0x7, "right": 0x9, "a": 0x6, "b": 0x4,
+}
+
+// Default returns the default keymap: the keyboard layout, with the arrow
+// keys and the gamepad bound to the most common keys for actions.
+func Default() Keymap {
+	return keyboard.WithActions(defaultActions)
+}
+
+// ForActions returns the default keymap with the arrow keys and the gamepad
+// bound to the keys a program uses for actions, as listed in the ROM
+// database; actions that are not listed keep their default keys.
+func ForActions(actions map[string]byte) Keymap {
+	return Default().WithActions(actions)
+}
+
+// WithActions returns a copy of a keymap with the inputs of actions such as
+// "up" or "a" bound to keys.
+func (k Keymap) WithActions(actions map[string]byte) Keymap {
+	m := k.Copy()
+	for action, key := range actions {
+		if key > 0xF {
+			continue
+		}
+		for _, input := range directions[action] {
+			m[input] = key
+		}
+	}
+	return m
+}
+
+func (k Keymap) Copy() Keymap {
+	m := make(Keymap, len(k))
+	for input, key := range k {
+		m[input] = key
+	}
+	return m
+}
+
+// Bind maps an input to a key, replacing any previous mapping of the input.
+func (k Keymap) Bind(input string, key byte) error {
+	if key > 0xF {
+		return fmt.Errorf("invalid key %#x", key)
+	}
+	k[input] = key
+	return nil
+}
+
+// Inputs returns the inputs mapped to a key, sorted by name.
+func (k Keymap) Inputs(key byte) []string {
+	inputs := []string{}
+	for input, v := range k {
+		if v == key {
+			inputs = append(inputs, input)
+		}
+	}
+	sort.Strings(inputs)
+	return inputs
+}
+
+// Decode reads a keymap stored as a JSON object of inputs and keys.
+func Decode(data []byte) (Keymap, error) {
+	k := Keymap{}
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("invalid keymap: %w", err)
+	}
+	for input, key := range k {
+		if key > 0xF {
+			return nil, fmt.Errorf("invalid key %#x for %s", key, input)
+		}
+	}
+	return k, nil
+}
+
+// Encode stores a keymap as a JSON object of inputs and keys.
+func (k Keymap) Encode() []byte {
+	data, _ := json.Marshal(k)
+	return data
+}
+
+// A Keypad tracks the state of the keypad from the inputs held; a key stays
+// pressed as long as any of the inputs mapped to it is held.
+type Keypad struct {
+	Keymap Keymap
+	held   map[string]bool
+}
+
+func NewKeypad(k Keymap) *Keypad {
+	return &Keypad{Keymap: k, held: map[string]bool{}}
+}
+
+// Input records the press or release of an input. It returns the key the
+// input is mapped to and if it is mapped at all.
+func (p *Keypad) Input(input string, pressed bool) (byte, bool) {
+	key, ok := p.Keymap[input]
+	if !ok {
+		return 0, false
+	}
+	if pressed {
+		p.held[input] = true
+	} else {
+		delete(p.held, input)
+	}
+	return key, true
+}
+
+// Keys returns the keys pressed.
+func (p *Keypad) Keys() [16]bool {
+	keys := [16]bool{}
+	for input := range p.held {
+		if key, ok := p.Keymap[input]; ok {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// Release releases all inputs, e.g. when the window loses focus.
+func (p *Keypad) Release() {
+	p.held = map[string]bool{}
+}
+
+// MinimalKeypad returns the keys a keypad needs to show to play a program:
+// those found by the static analysis of the program along with those the ROM
+// database lists for its actions. It reports false when these may not be all
+// the keys the program reads, in which case the whole keypad is needed, as for
+// programs using the key pressed for more than comparisons.
+func MinimalKeypad(usage chip8.KeyUsage, actions map[string]byte) ([16]bool, bool) {
+	if usage.AnyKey && usage.KeyValue {
+		return [16]bool{}, false
+	}
+	keys := usage.Keys
+	for _, key := range actions {
+		if key <= 0xF {
+			keys[key] = true
+		}
+	}
+	if !usage.Complete && len(actions) == 0 {
+		return [16]bool{}, false
+	}
+	for _, used := range keys {
+		if used {
+			return keys, true
+		}
+	}
+	return [16]bool{}, false
+}
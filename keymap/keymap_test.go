@@ -0,0 +1,92 @@
+package keymap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+func TestForActions(t *testing.T) {
+	k := ForActions(map[string]byte{"up": 0x2, "a": 0x10})
+	checks := map[string]byte{
+		"KeyQ":      0x4,
+		"ArrowUp":   0x2,
+		"Button12":  0x2,
+		"Axis1-":    0x2,
+		"ArrowDown": 0x8, // actions not listed keep their default key
+		"Space":     0x6, // keys out of range are ignored
+	}
+	for input, key := range checks {
+		if k[input] != key {
+			t.Errorf("ForActions err; %s: %x, expected: %x", input, k[input], key)
+		}
+	}
+	if Default()["ArrowUp"] != 0x5 {
+		t.Error("ForActions err; default keymap modified")
+	}
+}
+
+func TestKeypad(t *testing.T) {
+	p := NewKeypad(Default())
+	if key, ok := p.Input("KeyW", true); !ok || key != 0x5 {
+		t.Errorf("Keypad err; KeyW mapped to %x", key)
+	}
+	p.Input("ArrowUp", true)
+	p.Input("KeyW", false)
+	if !p.Keys()[0x5] {
+		t.Error("Keypad err; key released while an input mapped to it is held")
+	}
+	p.Input("ArrowUp", false)
+	if p.Keys()[0x5] {
+		t.Error("Keypad err; key still pressed")
+	}
+	if _, ok := p.Input("F13", true); ok {
+		t.Error("Keypad err; unmapped input accepted")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	k := Keymap{}
+	if err := k.Bind("KeyJ", 0x5); err != nil {
+		t.Fatal(err)
+	}
+	k.Bind("Button3", 0x5)
+	if err := k.Bind("KeyK", 0x10); err == nil {
+		t.Error("Bind err; invalid key accepted")
+	}
+	decoded, err := Decode(k.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, k) {
+		t.Errorf("Decode err; %v", decoded)
+	}
+	if inputs := decoded.Inputs(0x5); !reflect.DeepEqual(inputs, []string{"Button3", "KeyJ"}) {
+		t.Errorf("Inputs err; %v", inputs)
+	}
+	if _, err := Decode([]byte(`{"KeyJ": 16}`)); err == nil {
+		t.Error("Decode err; invalid key accepted")
+	}
+}
+
+func TestMinimalKeypad(t *testing.T) {
+	usage := chip8.KeyUsage{Complete: true}
+	usage.Keys[5] = true
+	keys, ok := MinimalKeypad(usage, map[string]byte{"a": 0x6})
+	if !ok || !keys[5] || !keys[6] || keys[4] {
+		t.Errorf("MinimalKeypad err; keys: %v, ok: %v", keys, ok)
+	}
+
+	usage.Complete = false
+	if _, ok := MinimalKeypad(usage, nil); ok {
+		t.Error("MinimalKeypad err; incomplete analysis accepted")
+	}
+	usage.AnyKey, usage.KeyValue = true, true
+	if _, ok := MinimalKeypad(usage, map[string]byte{"a": 0x6}); ok {
+		t.Error("MinimalKeypad err; keypad of a program entering digits accepted")
+	}
+	if _, ok := MinimalKeypad(chip8.KeyUsage{Complete: true}, nil); ok {
+		t.Error("MinimalKeypad err; empty keypad accepted")
+	}
+}
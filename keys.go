@@ -0,0 +1,151 @@
+package chip8
+
+// KeyUsage is what the static analysis of a program found out about the keys
+// it reads.
+type KeyUsage struct {
+	Keys     [16]bool // the keys the program tests with Ex9E and ExA1 or compares with the result of Fx0A
+	AnyKey   bool     // the program waits for a key with Fx0A
+	KeyValue bool     // the result of Fx0A is used for more than comparisons, e.g. entered as a digit, so any key may matter
+	Complete bool     // every key test has been resolved, so no other key is ever read
+}
+
+// register values tracked by the analysis besides the bytes themselves
+const (
+	unknownValue = -1
+	keyValue     = -2 // the key returned by Fx0A
+)
+
+type analysisState struct {
+	pc   uint16
+	regs [16]int
+}
+
+// AnalyzeKeys finds the keys a program reads by following the paths it can
+// take from its start and tracking the constants loaded into registers. It
+// does not run the program, so keys held in registers computed at runtime or
+// reached through jump tables cannot be resolved. Each instruction is only
+// analysed once, with the registers of the first path reaching it.
+func AnalyzeKeys(rom []byte) KeyUsage {
+	usage := KeyUsage{Complete: true}
+	useKey := func(v int) {
+		if v >= 0 && v <= 0xF {
+			usage.Keys[v] = true
+		}
+	}
+
+	start := analysisState{pc: 0x200}
+	for i := range start.regs {
+		start.regs[i] = unknownValue
+	}
+	visited := map[uint16]bool{}
+	paths := []analysisState{start}
+	for len(paths) > 0 {
+		s := paths[len(paths)-1]
+		paths = paths[:len(paths)-1]
+		for {
+			offset := int(s.pc) - 0x200
+			if offset < 0 || offset+1 >= len(rom) || visited[s.pc] {
+				break
+			}
+			visited[s.pc] = true
+			byte1, byte2 := rom[offset], rom[offset+1]
+			x, y := byte1&0xF, byte2>>4
+			s.pc += 2
+
+			// the instruction that may be skipped is also followed
+			skip := func() {
+				paths = append(paths, analysisState{pc: s.pc + 2, regs: s.regs})
+			}
+			compare := func(v int) {
+				if s.regs[x] == keyValue {
+					useKey(v)
+				}
+				skip()
+			}
+			// the result of Fx0A computed with or output can no longer be
+			// followed
+			useValue := func(regs ...byte) {
+				for _, r := range regs {
+					if s.regs[r] == keyValue {
+						usage.KeyValue = true
+						usage.Complete = false
+					}
+				}
+			}
+
+			switch byte1 >> 4 {
+			case 0x0:
+				if byte1 == 0x00 && (byte2 == 0xEE || byte2 == 0xFD) { // return or exit
+					s.pc = 0
+				}
+			case 0x1:
+				s.pc = uint16(byte1&0xF)<<8 | uint16(byte2)
+			case 0x2:
+				paths = append(paths, analysisState{pc: uint16(byte1&0xF)<<8 | uint16(byte2), regs: s.regs})
+				// the subroutine may change any register
+				for i := range s.regs {
+					s.regs[i] = unknownValue
+				}
+			case 0x3, 0x4:
+				compare(int(byte2))
+			case 0x5, 0x9:
+				compare(s.regs[y])
+			case 0x6:
+				s.regs[x] = int(byte2)
+			case 0x7:
+				useValue(x)
+				if s.regs[x] >= 0 {
+					s.regs[x] = (s.regs[x] + int(byte2)) & 0xFF
+				} else {
+					s.regs[x] = unknownValue
+				}
+			case 0x8:
+				if byte2&0xF == 0 {
+					s.regs[x] = s.regs[y]
+				} else {
+					useValue(x, y)
+					s.regs[x] = unknownValue
+				}
+				s.regs[0xF] = unknownValue
+			case 0xB:
+				// the target of a jump table depends on a register
+				usage.Complete = false
+				s.pc = 0
+			case 0xC:
+				s.regs[x] = unknownValue
+			case 0xD:
+				useValue(x, y)
+				s.regs[0xF] = unknownValue
+			case 0xE:
+				if byte2 == 0x9E || byte2 == 0xA1 {
+					switch {
+					case s.regs[x] >= 0:
+						useKey(s.regs[x] & 0xF) // only the lowest nibble is used as a key
+					case s.regs[x] == unknownValue:
+						usage.Complete = false
+					}
+					skip()
+				}
+			case 0xF:
+				switch byte2 {
+				case 0x0A:
+					usage.AnyKey = true
+					s.regs[x] = keyValue
+				case 0x07:
+					s.regs[x] = unknownValue
+				case 0x15, 0x18, 0x1E, 0x29, 0x33:
+					useValue(x)
+				case 0x55:
+					for i := byte(0); i <= x; i++ {
+						useValue(i)
+					}
+				case 0x65:
+					for i := 0; i <= int(x); i++ {
+						s.regs[i] = unknownValue
+					}
+				}
+			}
+		}
+	}
+	return usage
+}
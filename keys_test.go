@@ -0,0 +1,62 @@
+package chip8
+
+import "testing"
+
+func TestAnalyzeKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		rom   []byte
+		keys  []int
+		any   bool
+		value bool
+		known bool
+	}{
+		{
+			name: "constant keys",
+			// 6005 6107 E09E 220A 1204; 20A: E1A1 00EE
+			rom:   []byte{0x60, 0x05, 0x61, 0x07, 0xE0, 0x9E, 0x22, 0x0A, 0x12, 0x04, 0xE1, 0xA1, 0x00, 0xEE},
+			keys:  []int{5, 7},
+			known: true,
+		},
+		{
+			name: "key press compared",
+			// F10A E19E 1202 3101 4102 1200
+			rom:   []byte{0xF1, 0x0A, 0xE1, 0x9E, 0x12, 0x02, 0x31, 0x01, 0x41, 0x02, 0x12, 0x00},
+			keys:  []int{1, 2},
+			any:   true,
+			known: true,
+		},
+		{
+			name: "key press added to",
+			// F10A 7101 3105 1200
+			rom:   []byte{0xF1, 0x0A, 0x71, 0x01, 0x31, 0x05, 0x12, 0x00},
+			keys:  []int{},
+			any:   true,
+			value: true,
+		},
+		{
+			name: "key press displayed",
+			// F00A F029 D015 1200
+			rom:   []byte{0xF0, 0x0A, 0xF0, 0x29, 0xD0, 0x15, 0x12, 0x00},
+			keys:  []int{},
+			any:   true,
+			value: true,
+		},
+		{
+			name: "random key",
+			// C00F E0A1 1200
+			rom:  []byte{0xC0, 0x0F, 0xE0, 0xA1, 0x12, 0x00},
+			keys: []int{},
+		},
+	}
+	for _, test := range tests {
+		usage := AnalyzeKeys(test.rom)
+		expected := [16]bool{}
+		for _, k := range test.keys {
+			expected[k] = true
+		}
+		if usage.Keys != expected || usage.AnyKey != test.any || usage.KeyValue != test.value || usage.Complete != test.known {
+			t.Errorf("AnalyzeKeys err; %s: %+v", test.name, usage)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/gif"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/octo"
+)
+
+// octoOptions are the settings Octo stores alongside the program of a
+// cartridge.
+type octoOptions struct {
+	Tickrate        int             `json:"tickrate"`
+	BackgroundColor string          `json:"backgroundColor"`
+	FillColor       string          `json:"fillColor"`
+	FillColor2      string          `json:"fillColor2"`
+	BlendColor      string          `json:"blendColor"`
+	BuzzColor       string          `json:"buzzColor"`
+	QuietColor      string          `json:"quietColor"`
+	ShiftQuirks     bool            `json:"shiftQuirks"`
+	LoadStoreQuirks bool            `json:"loadStoreQuirks"`
+	ClipQuirks      bool            `json:"clipQuirks"`
+	JumpQuirks      bool            `json:"jumpQuirks"`
+	LogicQuirks     bool            `json:"logicQuirks"`
+	Keys            map[string]byte `json:"keys"` // key bindings, when the exporter stored any
+}
+
+func (opts octoOptions) apply(meta *Metadata) {
+	meta.Quirks = chip8.Quirks{
+		VFReset:  opts.LogicQuirks,
+		Memory:   !opts.LoadStoreQuirks,
+		Shifting: opts.ShiftQuirks,
+		Jumping:  opts.JumpQuirks,
+		Clipping: opts.ClipQuirks,
+	}
+	if opts.Tickrate != 0 {
+		meta.Tickrate = opts.Tickrate
+	}
+	if opts.BackgroundColor != "" {
+		meta.Colors = &Colors{
+			Pixels:  []string{opts.BackgroundColor, opts.FillColor, opts.FillColor2, opts.BlendColor},
+			Buzzer:  opts.BuzzColor,
+			Silence: opts.QuietColor,
+		}
+	}
+	if len(opts.Keys) > 0 {
+		meta.Keys = opts.Keys
+	}
+}
+
+// A Cartridge is the content of an Octo cartridge: the source code of a
+// program and the options it should be run with.
+type Cartridge struct {
+	Program string      `json:"program"`
+	Options octoOptions `json:"options"`
+}
+
+// DecodeCartridge extracts the payload of an Octo cartridge. Cartridges are
+// GIF images storing 2 bits of the payload in the lowest bits of the palette
+// index of each pixel, frame after frame. The payload is a JSON object
+// preceded by its length as a 32-bit big-endian integer.
+func DecodeCartridge(data []byte) (Cartridge, error) {
+	img, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return Cartridge{}, err
+	}
+
+	payload := []byte{}
+	var b byte
+	n := 0
+	for _, frame := range img.Image {
+		bounds := frame.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				b = b<<2 | frame.ColorIndexAt(x, y)&3
+				n++
+				if n%4 == 0 {
+					payload = append(payload, b)
+				}
+			}
+		}
+	}
+	if len(payload) < 4 {
+		return Cartridge{}, errors.New("cartridge has no payload")
+	}
+	size := binary.BigEndian.Uint32(payload)
+	if uint64(size) > uint64(len(payload)-4) {
+		return Cartridge{}, fmt.Errorf("cartridge payload is truncated; expected %d bytes, found %d", size, len(payload)-4)
+	}
+
+	cart := Cartridge{}
+	if err := json.Unmarshal(payload[4:4+size], &cart); err != nil {
+		return Cartridge{}, fmt.Errorf("invalid cartridge payload: %w", err)
+	}
+	return cart, nil
+}
+
+// isGif reports if data starts with the signature of a GIF image.
+func isGif(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+// loadCartridge assembles the program of a cartridge and configures it with
+// the cartridge options.
+func (db *Database) loadCartridge(data []byte) (Rom, error) {
+	cart, err := DecodeCartridge(data)
+	if err != nil {
+		return Rom{}, err
+	}
+	rom, err := db.loadOcto(cart.Program)
+	if err != nil {
+		return Rom{}, err
+	}
+	cart.Options.apply(&rom.Metadata)
+	return rom, nil
+}
+
+func (db *Database) loadOcto(source string) (Rom, error) {
+	data, err := octo.Assemble(source)
+	if err != nil {
+		return Rom{}, err
+	}
+	return Rom{Data: data, Metadata: db.Lookup(data)}, nil
+}
@@ -0,0 +1,58 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+// encodeCartridge stores a payload the way Octo does, 2 bits per pixel.
+func encodeCartridge(t *testing.T, payload string) []byte {
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	data = append(data, payload...)
+
+	img := image.NewPaletted(image.Rect(0, 0, 32, 32), palette.Plan9[:16])
+	i := 0
+	for _, b := range data {
+		for shift := 6; shift >= 0; shift -= 2 {
+			img.Pix[i] = 0x8 | (b>>shift)&3 // the upper bits draw the label
+			i++
+		}
+	}
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadCartridge(t *testing.T) {
+	cart := encodeCartridge(t, `{
+		"program": ": main\n  v0 := 1\n  jump main",
+		"options": {
+			"tickrate": 20,
+			"backgroundColor": "#996600",
+			"fillColor": "#FFCC00",
+			"shiftQuirks": true,
+			"clipQuirks": true
+		}
+	}`)
+
+	rom, err := Load("game.gif", cart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rom.Data, []byte{0x12, 0x02, 0x60, 0x01, 0x12, 0x02}) {
+		t.Errorf("Cartridge err; ROM: % x", rom.Data)
+	}
+	meta := rom.Metadata
+	if meta.Tickrate != 20 || !meta.Quirks.Shifting || !meta.Quirks.Clipping || meta.Quirks.VFReset || !meta.Quirks.Memory {
+		t.Errorf("Cartridge err; metadata: %+v", meta)
+	}
+	if meta.Colors == nil || meta.Colors.Pixels[0] != "#996600" || meta.Colors.Pixels[1] != "#FFCC00" {
+		t.Errorf("Cartridge err; colors: %+v", meta.Colors)
+	}
+}
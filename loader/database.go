@@ -0,0 +1,202 @@
+// Package loader prepares ROMs to be run by the chip8 package; it identifies
+// them and configures the VM with the settings they were written for.
+package loader
+
+import (
+	"crypto/sha1"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+// The database files follow the format of the community CHIP-8 database
+// (https://github.com/chip-8/chip-8-database); `make database` downloads them,
+// and the tests of the package fail while no program has been downloaded.
+//
+//go:embed database/*.json
+var databaseFS embed.FS
+
+// Default is the database embedded in the binary.
+var Default = mustLoadDatabase(databaseFS)
+
+// Colors are the colours a ROM should be displayed with, as CSS hex strings.
+type Colors struct {
+	Pixels  []string `json:"pixels"`  // the colour of each pixel value, starting with the background
+	Buzzer  string   `json:"buzzer"`  // the background colour while the sound timer is active
+	Silence string   `json:"silence"` // the background colour while the sound timer is inactive
+}
+
+type Metadata struct {
+	Hash     string          // the SHA-1 hash of the ROM
+	Known    bool            // if the ROM has been found in the database
+	Title    string          `json:",omitempty"`
+	Authors  []string        `json:",omitempty"`
+	Platform string          `json:",omitempty"` // the ID of the platform the ROM was written for
+	Quirks   chip8.Quirks    // the quirks required to run the ROM correctly
+	Tickrate int             `json:",omitempty"` // the recommended number of instructions per frame
+	Keys     map[string]byte `json:",omitempty"` // the keypad keys used for actions, e.g. "up" or "a"
+	Colors   *Colors         `json:",omitempty"`
+}
+
+type platformQuirks struct {
+	Shift                 bool `json:"shift"`
+	MemoryIncrementByX    bool `json:"memoryIncrementByX"`
+	MemoryLeaveIUnchanged bool `json:"memoryLeaveIUnchanged"`
+	Wrap                  bool `json:"wrap"`
+	Jump                  bool `json:"jump"`
+	VBlank                bool `json:"vblank"`
+	Logic                 bool `json:"logic"`
+}
+
+// overrideQuirks applies the quirks a ROM sets on top of those of its platform.
+func overrideQuirks(overrides map[string]bool, quirks *chip8.Quirks) {
+	for name, val := range overrides {
+		switch name {
+		case "shift":
+			quirks.Shifting = val
+		case "memoryLeaveIUnchanged":
+			quirks.Memory = !val
+		case "wrap":
+			quirks.Clipping = !val
+		case "jump":
+			quirks.Jumping = val
+		case "logic":
+			quirks.VFReset = val
+		}
+	}
+}
+
+// quirks converts the quirks of a platform into the ones supported by the VM;
+// `memoryIncrementByX` and `vblank` have no counterpart and are ignored.
+func (pq platformQuirks) quirks() chip8.Quirks {
+	return chip8.Quirks{
+		VFReset:  pq.Logic,
+		Memory:   !pq.MemoryLeaveIUnchanged,
+		Shifting: pq.Shift,
+		Jumping:  pq.Jump,
+		Clipping: !pq.Wrap,
+	}
+}
+
+type platform struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	DefaultTickrate int            `json:"defaultTickrate"`
+	Quirks          platformQuirks `json:"quirks"`
+}
+
+type rom struct {
+	Platforms       []string                   `json:"platforms"`
+	QuirkyPlatforms map[string]map[string]bool `json:"quirkyPlatforms"`
+	Tickrate        int                        `json:"tickrate"`
+	Keys            map[string]byte            `json:"keys"`
+	Colors          *Colors                    `json:"colors"`
+}
+
+type program struct {
+	Title   string         `json:"title"`
+	Authors []string       `json:"authors"`
+	Roms    map[string]rom `json:"roms"`
+}
+
+type Database struct {
+	hashes    map[string]int // ROM hash -> index in programs
+	programs  []program
+	platforms map[string]platform
+}
+
+func readJSON(fsys fs.FS, name string, v any) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// LoadDatabase reads the `sha1-hashes.json`, `programs.json` and
+// `platforms.json` files found in the `database` directory of fsys.
+func LoadDatabase(fsys fs.FS) (*Database, error) {
+	db := &Database{}
+	if err := readJSON(fsys, "database/sha1-hashes.json", &db.hashes); err != nil {
+		return nil, err
+	}
+	if err := readJSON(fsys, "database/programs.json", &db.programs); err != nil {
+		return nil, err
+	}
+	platforms := []platform{}
+	if err := readJSON(fsys, "database/platforms.json", &platforms); err != nil {
+		return nil, err
+	}
+	db.platforms = make(map[string]platform, len(platforms))
+	for _, p := range platforms {
+		db.platforms[p.ID] = p
+	}
+	for hash, i := range db.hashes {
+		if i < 0 || i >= len(db.programs) {
+			return nil, fmt.Errorf("hash %s refers to unknown program %d", hash, i)
+		}
+	}
+	return db, nil
+}
+
+func mustLoadDatabase(fsys fs.FS) *Database {
+	db, err := LoadDatabase(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// Hash returns the SHA-1 hash of a ROM as a hex string.
+func Hash(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the metadata of a ROM. A ROM that is not in the database is
+// given the quirks of the original interpreter.
+func (db *Database) Lookup(data []byte) Metadata {
+	return db.lookupHash(Hash(data))
+}
+
+func (db *Database) lookupHash(hash string) Metadata {
+	meta := Metadata{
+		Hash:   hash,
+		Quirks: chip8.ChipQuirks,
+	}
+	i, ok := db.hashes[meta.Hash]
+	if !ok {
+		return meta
+	}
+	prog := db.programs[i]
+	r := prog.Roms[meta.Hash]
+	meta.Known = true
+	meta.Title = prog.Title
+	meta.Authors = prog.Authors
+	meta.Keys = r.Keys
+	meta.Colors = r.Colors
+	meta.Tickrate = r.Tickrate
+
+	// Prefer the first platform the VM knows the quirks of
+	for _, id := range r.Platforms {
+		p, ok := db.platforms[id]
+		if !ok {
+			continue
+		}
+		meta.Platform = id
+		meta.Quirks = p.Quirks.quirks()
+		overrideQuirks(r.QuirkyPlatforms[id], &meta.Quirks)
+		if meta.Tickrate == 0 {
+			meta.Tickrate = p.DefaultTickrate
+		}
+		break
+	}
+	return meta
+}
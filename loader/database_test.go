@@ -0,0 +1,100 @@
+package loader
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+func TestLookup(t *testing.T) {
+	rom := []byte{0x12, 0x00}
+	hash := Hash(rom)
+	db, err := LoadDatabase(fstest.MapFS{
+		"database/sha1-hashes.json": {Data: []byte(`{"` + hash + `": 0}`)},
+		"database/programs.json": {Data: []byte(`[{
+			"title": "Loop",
+			"authors": ["Someone"],
+			"roms": {"` + hash + `": {
+				"platforms": ["superchip"],
+				"quirkyPlatforms": {"superchip": {"wrap": true}},
+				"keys": {"up": 5}
+			}}
+		}]`)},
+		"database/platforms.json": {Data: []byte(`[{
+			"id": "superchip",
+			"defaultTickrate": 30,
+			"quirks": {"shift": true, "memoryLeaveIUnchanged": true, "jump": true}
+		}]`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := db.Load("loop.ch8", rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := loaded.Metadata
+	vm, params, err := loaded.Boot(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Known || meta.Title != "Loop" || meta.Platform != "superchip" || meta.Keys["up"] != 5 {
+		t.Errorf("Lookup err; metadata: %+v", meta)
+	}
+	expected := chip8.Quirks{Shifting: true, Jumping: true}
+	if vm.Quirks != expected {
+		t.Errorf("Lookup err; expected quirks: %+v, received: %+v", expected, vm.Quirks)
+	}
+	if params.InstCount != 30 {
+		t.Errorf("Lookup err; tickrate: %d", params.InstCount)
+	}
+
+	meta = db.Lookup([]byte{0x00, 0xE0})
+	if meta.Known || meta.Quirks != chip8.ChipQuirks {
+		t.Errorf("Lookup err; unknown ROM metadata: %+v", meta)
+	}
+}
+
+func TestDefaultDatabase(t *testing.T) {
+	if len(Default.platforms) == 0 {
+		t.Error("Embedded database has no platforms")
+	}
+	if len(Default.programs) == 0 || len(Default.hashes) == 0 {
+		t.Error("Embedded database has no programs; run `make database`")
+	}
+}
+
+// TestPong checks that the ROMs of Pong in the embedded database resolve to
+// its title and to the quirks and tickrate of the platform they were written
+// for.
+func TestPong(t *testing.T) {
+	found := 0
+	for hash, i := range Default.hashes {
+		prog := Default.programs[i]
+		if !strings.HasPrefix(prog.Title, "Pong") {
+			continue
+		}
+		found++
+		r := prog.Roms[hash]
+		meta := Default.lookupHash(hash)
+		if !meta.Known || meta.Title != prog.Title || meta.Platform == "" || meta.Tickrate == 0 {
+			t.Errorf("Pong err; %s: %+v", hash, meta)
+			continue
+		}
+		p := Default.platforms[meta.Platform]
+		expected := p.Quirks.quirks()
+		overrideQuirks(r.QuirkyPlatforms[meta.Platform], &expected)
+		if meta.Quirks != expected {
+			t.Errorf("Pong err; %s: expected quirks: %+v, received: %+v", hash, expected, meta.Quirks)
+		}
+		if tickrate := r.Tickrate; tickrate == 0 && meta.Tickrate != p.DefaultTickrate || tickrate != 0 && meta.Tickrate != tickrate {
+			t.Errorf("Pong err; %s: tickrate %d", hash, meta.Tickrate)
+		}
+	}
+	if found == 0 {
+		t.Error("Pong err; no ROM of Pong in the embedded database; run `make database`")
+	}
+}
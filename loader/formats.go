@@ -0,0 +1,254 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format is the encoding a ROM file is stored in.
+type Format int
+
+const (
+	Raw           Format = iota // a binary image of the program
+	IntelHex                    // Intel HEX records
+	HexText                     // hex bytes separated by whitespace or commas
+	OctoSource                  // Octo source code
+	OctoCartridge               // an Octo cartridge GIF
+)
+
+func (f Format) String() string {
+	switch f {
+	case IntelHex:
+		return "Intel HEX"
+	case HexText:
+		return "hex text"
+	case OctoSource:
+		return "Octo source"
+	case OctoCartridge:
+		return "Octo cartridge"
+	default:
+		return "raw"
+	}
+}
+
+// Detect guesses the format of a ROM file from its name and contents.
+func Detect(name string, data []byte) Format {
+	ext := strings.ToLower(path.Ext(name))
+	switch {
+	case isGif(data):
+		return OctoCartridge
+	case ext == ".8o":
+		return OctoSource
+	case ext == ".ch8" || ext == ".c8":
+		return Raw
+	case isIntelHex(data):
+		return IntelHex
+	case isHexText(data):
+		return HexText
+	default:
+		return Raw
+	}
+}
+
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, c := range data {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+func isIntelHex(data []byte) bool {
+	if !isText(data) {
+		return false
+	}
+	lines := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if len(line) < 11 || line[0] != ':' {
+			return false
+		}
+		if _, err := hex.DecodeString(line[1:]); err != nil {
+			return false
+		}
+		lines++
+	}
+	return lines > 0
+}
+
+// decodeIntelHex converts Intel HEX records into a ROM. Records addressed at
+// 0x200 and above are taken to be a memory image and are rebased to the start
+// of the program.
+func decodeIntelHex(data []byte) ([]byte, error) {
+	type record struct {
+		addr int
+		data []byte
+	}
+	records := []record{}
+	base := 0 // set by extended address records
+	lowest := -1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+records:
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields, _ := hex.DecodeString(line[1:])
+		if len(fields) < 5 || int(fields[0]) != len(fields)-5 {
+			return nil, fmt.Errorf("line %d: invalid record length", lineNum)
+		}
+		var sum byte
+		for _, b := range fields {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("line %d: invalid checksum", lineNum)
+		}
+
+		addr := int(fields[1])<<8 | int(fields[2])
+		payload := fields[4 : len(fields)-1]
+		switch fields[3] {
+		case 0x00: // data
+			addr += base
+			records = append(records, record{addr: addr, data: payload})
+			if lowest < 0 || addr < lowest {
+				lowest = addr
+			}
+		case 0x01: // end of file
+			break records
+		case 0x02: // extended segment address
+			if len(payload) != 2 {
+				return nil, fmt.Errorf("line %d: invalid extended segment address", lineNum)
+			}
+			base = (int(payload[0])<<8 | int(payload[1])) << 4
+		case 0x04: // extended linear address
+			if len(payload) != 2 {
+				return nil, fmt.Errorf("line %d: invalid extended linear address", lineNum)
+			}
+			base = (int(payload[0])<<8 | int(payload[1])) << 16
+		case 0x03, 0x05: // start addresses are meaningless to CHIP-8
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type %#x", lineNum, fields[3])
+		}
+	}
+	if lowest < 0 {
+		return []byte{}, nil
+	}
+
+	start := 0
+	if lowest >= 0x200 {
+		start = 0x200
+	}
+	rom := []byte{}
+	for _, r := range records {
+		offset := r.addr - start
+		if offset+len(r.data) > 0x1000 {
+			return nil, fmt.Errorf("record at %#x is out of range", r.addr)
+		}
+		for len(rom) < offset+len(r.data) {
+			rom = append(rom, 0)
+		}
+		copy(rom[offset:], r.data)
+	}
+	return rom, nil
+}
+
+// hexTokens splits hex text into the hex digits of each of its tokens,
+// dropping `0x` and `$` prefixes and skipping address labels like `200:`.
+func hexTokens(data []byte) ([]string, bool) {
+	tokens := strings.FieldsFunc(string(data), func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == ','
+	})
+	digits := make([]string, 0, len(tokens))
+	for _, tok := range tokens {
+		if strings.HasSuffix(tok, ":") {
+			continue
+		}
+		tok = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(tok, "0x"), "0X"), "$")
+		if len(tok) == 0 || len(tok)%2 != 0 {
+			return nil, false
+		}
+		if _, err := hex.DecodeString(tok); err != nil {
+			return nil, false
+		}
+		digits = append(digits, tok)
+	}
+	return digits, len(digits) > 0
+}
+
+func isHexText(data []byte) bool {
+	if !isText(data) {
+		return false
+	}
+	_, ok := hexTokens(data)
+	return ok
+}
+
+func decodeHexText(data []byte) ([]byte, error) {
+	tokens, ok := hexTokens(data)
+	if !ok {
+		return nil, fmt.Errorf("invalid hex text")
+	}
+	rom := []byte{}
+	for _, tok := range tokens {
+		b, _ := hex.DecodeString(tok)
+		rom = append(rom, b...)
+	}
+	return rom, nil
+}
+
+// DecodeBase64 decodes a ROM encoded in base64, with either the standard or
+// the URL-safe alphabet and with or without padding.
+func DecodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	if strings.ContainsAny(s, "-_") {
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// ParseFragment extracts a ROM from the fragment of a URL such as
+// `#rom=<base64>&name=pong.ch8`, letting a link boot a specific ROM. The
+// optional name helps detecting the format of the decoded ROM.
+func ParseFragment(fragment string) (name string, data []byte, err error) {
+	values, err := url.ParseQuery(strings.TrimPrefix(fragment, "#"))
+	if err != nil {
+		return "", nil, err
+	}
+	// a `+` of the standard alphabet that was not escaped is read as a space
+	encoded := strings.ReplaceAll(values.Get("rom"), " ", "+")
+	if encoded == "" {
+		return "", nil, fmt.Errorf("URL fragment has no ROM")
+	}
+	data, err = DecodeBase64(encoded)
+	if err != nil {
+		return "", nil, err
+	}
+	return values.Get("name"), data, nil
+}
+
+// Fragment encodes a ROM as the URL fragment ParseFragment extracts it from,
+// with the URL-safe alphabet.
+func Fragment(name string, data []byte) string {
+	values := url.Values{"rom": {base64.RawURLEncoding.EncodeToString(data)}}
+	if name != "" {
+		values.Set("name", name)
+	}
+	return "#" + values.Encode()
+}
@@ -0,0 +1,51 @@
+package loader
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormats(t *testing.T) {
+	rom := []byte{0xA2, 0x2A, 0x60, 0x0C, 0x12, 0x00}
+	for _, tc := range []struct {
+		name   string
+		data   string
+		format Format
+	}{
+		{"pong.ch8", string(rom), Raw},
+		{"pong.hex", ":06020000A22A600C1200AE\n:00000001FF\n", IntelHex},
+		{"", ":06000000A22A600C1200B0\r\n:00000001FF\r\n", IntelHex},
+		{"forum.txt", "A2 2A 60 0C\n12 00\n", HexText},
+		{"", "0200: 0xA2, 0x2A, 0x60, 0x0C, 0x12, 0x00", HexText},
+		{"", "A22A 600C 1200", HexText},
+	} {
+		loaded, err := Load(tc.name, []byte(tc.data))
+		if err != nil {
+			t.Errorf("Load err; %q: %v", tc.data, err)
+			continue
+		}
+		if loaded.Format != tc.format || !bytes.Equal(loaded.Data, rom) {
+			t.Errorf("Load err; %q: format: %v, data: % x", tc.data, loaded.Format, loaded.Data)
+		}
+	}
+
+	if _, err := Load("", []byte(":06020000A22A600C1200AF\n")); err == nil {
+		t.Error("Load err; Intel HEX checksum not verified")
+	}
+}
+
+func TestParseFragment(t *testing.T) {
+	rom := []byte{0xA2, 0x2A, 0xFB, 0xFF}
+	for _, fragment := range []string{"#rom=oir7/w==&name=a.ch8", "#rom=oir7_w&name=a.ch8", "#name=a.ch8&rom=oir7/w"} {
+		name, data, err := ParseFragment(fragment)
+		if err != nil || name != "a.ch8" || !bytes.Equal(data, rom) {
+			t.Errorf("ParseFragment err; %s: name: %s, data: % x, err: %v", fragment, name, data, err)
+		}
+	}
+	if name, data, err := ParseFragment(Fragment("a b.ch8", rom)); err != nil || name != "a b.ch8" || !bytes.Equal(data, rom) {
+		t.Errorf("Fragment err; name: %s, data: % x, err: %v", name, data, err)
+	}
+	if _, _, err := ParseFragment("#debug"); err == nil {
+		t.Error("ParseFragment err; fragment without a ROM accepted")
+	}
+}
@@ -0,0 +1,59 @@
+package loader
+
+import (
+	"fmt"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+// A Rom is a program ready to be loaded into the VM along with what is known
+// about it.
+type Rom struct {
+	Data     []byte
+	Format   Format // the format the ROM was loaded from
+	Metadata Metadata
+}
+
+// Load prepares a ROM from the contents of a file, detecting its format. Octo
+// cartridges and source files are assembled and text formats are decoded.
+func (db *Database) Load(name string, data []byte) (Rom, error) {
+	var rom Rom
+	var err error
+	format := Detect(name, data)
+	switch format {
+	case OctoCartridge:
+		rom, err = db.loadCartridge(data)
+	case OctoSource:
+		rom, err = db.loadOcto(string(data))
+	case IntelHex:
+		rom.Data, err = decodeIntelHex(data)
+	case HexText:
+		rom.Data, err = decodeHexText(data)
+	default:
+		rom.Data = data
+	}
+	if err != nil {
+		return Rom{}, fmt.Errorf("%s: %w", format, err)
+	}
+	if format != OctoCartridge && format != OctoSource {
+		rom.Metadata = db.Lookup(rom.Data)
+	}
+	rom.Format = format
+	return rom, nil
+}
+
+// Load prepares a ROM using the embedded database.
+func Load(name string, data []byte) (Rom, error) {
+	return Default.Load(name, data)
+}
+
+// Boot creates a VM for the ROM configured with the quirks and tickrate of its
+// metadata.
+func (rom Rom) Boot(io chip8.IO) (chip8.Vm, chip8.RunParams, error) {
+	vm, err := chip8.NewVm(rom.Data, io)
+	if err != nil {
+		return vm, chip8.RunParams{}, err
+	}
+	vm.Quirks = rom.Metadata.Quirks
+	return vm, chip8.RunParams{InstCount: rom.Metadata.Tickrate}, nil
+}
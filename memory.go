@@ -0,0 +1,131 @@
+package chip8
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PageSize is the number of bytes in a page of the memory view.
+const PageSize = 256
+
+// RowSize is the number of bytes in a row of the memory view.
+const RowSize = 16
+
+// MemoryMark flags bytes of the memory view that are of interest.
+type MemoryMark uint8
+
+const (
+	MarkI      MemoryMark = 1 << iota // the byte I points to
+	MarkPc                            // the instruction about to be executed
+	MarkSprite                        // the sprite drawn by the last Dxyn
+)
+
+// MemoryRow is a row of the memory view.
+type MemoryRow struct {
+	Addr  uint16
+	Bytes []byte
+	Marks []MemoryMark
+	ASCII string // the printable bytes, with a dot for the others
+}
+
+// Pages returns the number of pages of memory.
+func (vm *Vm) Pages() int {
+	return (len(vm.Mem) + PageSize - 1) / PageSize
+}
+
+// MemoryPage returns the rows of a page of memory.
+func (vm *Vm) MemoryPage(page int) []MemoryRow {
+	rows := []MemoryRow{}
+	if page < 0 || page >= vm.Pages() {
+		return rows
+	}
+	end := (page + 1) * PageSize
+	if end > len(vm.Mem) {
+		end = len(vm.Mem)
+	}
+	for start := page * PageSize; start < end; start += RowSize {
+		rowEnd := start + RowSize
+		if rowEnd > end {
+			rowEnd = end
+		}
+		row := MemoryRow{
+			Addr:  uint16(start),
+			Bytes: vm.Mem[start:rowEnd],
+			Marks: make([]MemoryMark, rowEnd-start),
+		}
+		var ascii strings.Builder
+		for i, b := range row.Bytes {
+			row.Marks[i] = vm.memoryMark(uint16(start + i))
+			if b >= 0x20 && b < 0x7F {
+				ascii.WriteByte(b)
+			} else {
+				ascii.WriteByte('.')
+			}
+		}
+		row.ASCII = ascii.String()
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (vm *Vm) memoryMark(addr uint16) MemoryMark {
+	var mark MemoryMark
+	if addr == vm.I {
+		mark |= MarkI
+	}
+	if addr == vm.Pc || addr == vm.Pc+1 {
+		mark |= MarkPc
+	}
+	if sprite := vm.LastSprite; addr >= sprite.Addr && int(addr-sprite.Addr) < sprite.Height {
+		mark |= MarkSprite
+	}
+	return mark
+}
+
+// Poke changes a byte of memory. Instructions are decoded from memory each
+// time they are executed, so the change applies to the next execution of an
+// instruction it is part of.
+func (vm *Vm) Poke(addr uint16, value byte) error {
+	if int(addr) >= len(vm.Mem) {
+		return fmt.Errorf("address %#x is out of memory", addr)
+	}
+	vm.Mem[addr] = value
+	return nil
+}
+
+// SetRegister changes a register by its name: V0 to VF, I, PC, SP, DT or ST.
+func (vm *Vm) SetRegister(name string, value int) error {
+	name = strings.ToUpper(name)
+	max := 0xFF
+	switch name {
+	case "I":
+		max = len(vm.Mem) - 1
+	case "PC":
+		max = len(vm.Mem) - 2 // the last instruction in memory
+	case "SP":
+		max = len(vm.Stack) // the stack is full after 16 nested calls
+	}
+	if value < 0 || value > max {
+		return fmt.Errorf("%s: value %#x is out of range", name, value)
+	}
+
+	switch name {
+	case "I":
+		vm.I = uint16(value)
+	case "PC":
+		vm.Pc = uint16(value)
+	case "SP":
+		vm.Sp = byte(value)
+	case "DT":
+		vm.DT = byte(value)
+	case "ST":
+		vm.ST = byte(value)
+	default:
+		var reg int
+		if _, err := fmt.Sscanf(name, "V%1X", &reg); err != nil || len(name) != 2 {
+			return fmt.Errorf("unknown register %s", name)
+		}
+		vm.Regs[reg] = byte(value)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package chip8
+
+import "testing"
+
+func TestMemoryPage(t *testing.T) {
+	rom := []byte{0xA2, 0x06, 0xD0, 0x02, 0x12, 0x04, 'H', 'i'}
+
+	vm, _ := NewVm(rom, testIO)
+	vm.Run(RunParams{InstCount: 2, FrameDuration: 1})
+	rows := vm.MemoryPage(2)
+	if len(rows) != PageSize/RowSize || rows[0].Addr != 0x200 {
+		t.Fatalf("Memory page err; rows: %d", len(rows))
+	}
+	if rows[0].ASCII[:8] != "......Hi" {
+		t.Errorf("Memory page err; ASCII: %q", rows[0].ASCII)
+	}
+	marks := rows[0].Marks
+	if marks[4] != MarkPc || marks[5] != MarkPc || marks[6] != MarkI|MarkSprite || marks[7] != MarkSprite {
+		t.Errorf("Memory page err; marks: %v", marks[:8])
+	}
+
+	last := vm.MemoryPage(vm.Pages() - 1)
+	if end := last[len(last)-1]; int(end.Addr)+len(end.Bytes) != len(vm.Mem) {
+		t.Errorf("Memory page err; last row ends at %x", int(end.Addr)+len(end.Bytes))
+	}
+	if len(vm.MemoryPage(vm.Pages())) != 0 {
+		t.Error("Memory page err; page out of memory")
+	}
+}
+
+func TestPokeAndSetRegister(t *testing.T) {
+	vm, _ := NewVm([]byte{0x60, 0x01}, testIO)
+	if err := vm.Poke(0x201, 0x42); err != nil {
+		t.Fatal(err)
+	}
+	vm.Run(runParams)
+	if vm.Regs[0] != 0x42 {
+		t.Errorf("Poke err; V0: %x", vm.Regs[0])
+	}
+	if err := vm.Poke(0x1000, 0); err == nil {
+		t.Error("Poke err; address out of memory accepted")
+	}
+
+	if err := vm.SetRegister("vA", 0x12); err != nil || vm.Regs[0xA] != 0x12 {
+		t.Errorf("Set register err; VA: %x, %v", vm.Regs[0xA], err)
+	}
+	if err := vm.SetRegister("I", 0x300); err != nil || vm.I != 0x300 {
+		t.Errorf("Set register err; I: %x, %v", vm.I, err)
+	}
+	for _, bad := range []struct {
+		name  string
+		value int
+	}{{"V0", 0x100}, {"VG", 1}, {"V10", 1}, {"SP", 17}, {"X", 0}} {
+		if err := vm.SetRegister(bad.name, bad.value); err == nil {
+			t.Errorf("Set register err; %s = %x accepted", bad.name, bad.value)
+		}
+	}
+}
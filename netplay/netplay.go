@@ -0,0 +1,307 @@
+// Package netplay lets two players play a ROM on the same keypad from two
+// machines. Each machine runs the VM, whose runs are deterministic, and the
+// players exchange the keys they hold each frame, so that both VMs run the
+// same frames with the same keys, or lockstep.
+//
+// The keys of the local player are only used a few frames after they are
+// pressed, the input delay, which gives them time to reach the other machine.
+// When the keys of the other player are late, the frame is run with the keys
+// they held last; once their keys arrive and turn out to be different, the
+// frames run since are rolled back with save states and run again. Machines
+// regularly exchange the hashes of their states to detect desyncs.
+//
+// The hooks of the VM, e.g. achievements, are only called for the frames run
+// with the keys of both players known, which are never rolled back; the
+// frames run before the keys of the other player arrive are run again for
+// them once they have.
+package netplay
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+// MaxRollback is the number of frames the VM can run ahead of the keys of the
+// other player; beyond it, the VM stalls until they arrive.
+const MaxRollback = 30
+
+// HashInterval is the number of frames between the states whose hashes are
+// compared.
+const HashInterval = 60
+
+// Message types; the server relaying messages between the players sends
+// those about the room, and the players send each other the others.
+const (
+	Joined = "joined" // the player joined the room as Player
+	Peer   = "peer"   // the other player joined the room
+	Left   = "left"   // the other player left the room
+	Start  = "start"  // the first player starts a game of the ROM with Hash
+	Input  = "input"  // the keys a player holds in Frame
+	Hash   = "hash"   // the hash of the state at the start of Frame
+)
+
+// Message is a message exchanged by the players, as JSON.
+type Message struct {
+	Type   string
+	Player int    `json:",omitempty"`
+	Frame  int    `json:",omitempty"`
+	Keys   uint16 `json:",omitempty"` // key k is bit k
+	Hash   string `json:",omitempty"` // the hash of the ROM or of a state
+	Seed   int64  `json:",omitempty"`
+	Ticks  int    `json:",omitempty"` // the number of instructions per frame
+	Delay  int    `json:",omitempty"` // the input delay, in frames
+}
+
+func packKeys(keys [16]bool) uint16 {
+	var k uint16
+	for key, pressed := range keys {
+		if pressed {
+			k |= 1 << key
+		}
+	}
+	return k
+}
+
+func unpackKeys(k uint16) [16]bool {
+	keys := [16]bool{}
+	for key := range keys {
+		keys[key] = k&(1<<key) != 0
+	}
+	return keys
+}
+
+// Session runs a VM in lockstep with the VM of the other player.
+type Session struct {
+	vm     *chip8.Vm
+	io     *sessionIO
+	params chip8.RunParams
+	send   func(Message)
+	delay  int
+
+	frame     int            // the next frame to run
+	local     map[int]uint16 // the keys of the local player by frame
+	remote    map[int]uint16 // the keys of the other player received, by frame
+	predicted map[int]uint16 // the keys of the other player frames were run with
+	confirmed int            // the last frame the keys of the other player are known for
+	states    map[int]chip8.State
+	rollback  int // the first frame run with mispredicted keys, or -1
+	hooked    int // the first frame the hooks of the VM have not been called for
+
+	nextHash   int
+	hashes     map[int]string // the hashes of the states of the frames not yet compared
+	peerHashes map[int]string
+
+	Rollbacks int // the number of frames run again
+	Desync    int // the first frame whose states differ, or -1
+}
+
+// sessionIO presents the display as the IO of the VM did, and reads the keys
+// of both players.
+type sessionIO struct {
+	io   chip8.IO
+	keys [16]bool
+}
+
+func (i *sessionIO) Draw(pixels chip8.Pixels, dirty chip8.Region) {
+	if i.io != nil {
+		i.io.Draw(pixels, dirty)
+	}
+}
+
+func (i *sessionIO) GetKeysPressed() [16]bool {
+	return i.keys
+}
+
+// NewSession starts a session running a VM from its current state, which
+// must be the same on both machines; send sends messages to the other player.
+// The keys the VM reads are those of both players until the session is
+// closed.
+func NewSession(vm *chip8.Vm, params chip8.RunParams, delay int, send func(Message)) *Session {
+	io := &sessionIO{io: vm.IO}
+	vm.IO = io
+	return &Session{
+		vm:         vm,
+		io:         io,
+		params:     params,
+		send:       send,
+		delay:      delay,
+		local:      map[int]uint16{},
+		remote:     map[int]uint16{},
+		predicted:  map[int]uint16{},
+		confirmed:  delay - 1, // no key is held during the delay
+		states:     map[int]chip8.State{},
+		rollback:   -1,
+		nextHash:   HashInterval,
+		hashes:     map[int]string{},
+		peerHashes: map[int]string{},
+		Desync:     -1,
+	}
+}
+
+// Close gives the VM its IO back.
+func (s *Session) Close() {
+	s.vm.IO = s.io.io
+	if s.vm.Hooks != nil {
+		s.vm.Hooks.Muted = false
+	}
+}
+
+// Frame returns the number of frames run.
+func (s *Session) Frame() int {
+	return s.frame
+}
+
+// Stalled reports whether the VM waits for the keys of the other player.
+func (s *Session) Stalled() bool {
+	return s.frame > s.confirmed+MaxRollback
+}
+
+// Receive handles the keys and hashes sent by the other player.
+func (s *Session) Receive(msg Message) {
+	switch msg.Type {
+	case Input:
+		if msg.Frame <= s.confirmed {
+			return
+		}
+		s.remote[msg.Frame] = msg.Keys
+		for s.hasRemote(s.confirmed + 1) {
+			s.confirmed++
+			f := s.confirmed
+			if f < s.frame && s.predicted[f] != s.remote[f] && (s.rollback == -1 || f < s.rollback) {
+				s.rollback = f
+			}
+		}
+	case Hash:
+		s.peerHashes[msg.Frame] = msg.Hash
+		s.compareHashes()
+	}
+}
+
+func (s *Session) hasRemote(frame int) bool {
+	_, ok := s.remote[frame]
+	return ok
+}
+
+// remoteKeys returns the keys of the other player in a frame, predicted to be
+// those held in the last frame they are known for if they are not known yet.
+func (s *Session) remoteKeys(frame int) uint16 {
+	if frame < s.delay {
+		return 0
+	}
+	if keys, ok := s.remote[frame]; ok {
+		return keys
+	}
+	return s.remote[s.confirmed]
+}
+
+// runFrame runs a frame with the keys of both players, saving the state it
+// starts from in case it has to be run again. The hooks of the VM are muted
+// unless the keys are known, and it is the next frame they are called for.
+func (s *Session) runFrame() error {
+	s.states[s.frame] = s.vm.SaveState()
+	s.predicted[s.frame] = s.remoteKeys(s.frame)
+	s.io.keys = unpackKeys(s.local[s.frame] | s.predicted[s.frame])
+	hooked := s.frame == s.hooked && s.frame <= s.confirmed
+	if s.vm.Hooks != nil {
+		s.vm.Hooks.Muted = !hooked
+	}
+	if err := s.vm.RunFrame(s.params); err != nil {
+		return err
+	}
+	if hooked {
+		s.hooked++
+	}
+	s.frame++
+	return nil
+}
+
+// replayFrom returns the first frame to run again: the first frame run with
+// mispredicted keys, or the first frame run with muted hooks whose keys are
+// now known. It is -1 when there is none.
+func (s *Session) replayFrom() int {
+	if s.hooked == s.frame || s.hooked > s.confirmed {
+		return s.rollback
+	}
+	if s.vm.Hooks == nil { // no hook to call
+		s.hooked = s.confirmed + 1
+		if s.hooked > s.frame {
+			s.hooked = s.frame
+		}
+		return s.rollback
+	}
+	if s.rollback == -1 || s.hooked < s.rollback {
+		return s.hooked
+	}
+	return s.rollback
+}
+
+// Advance runs the next frame with the keys held by the local player, which
+// are sent to the other player. Frames run with mispredicted keys, or with
+// muted hooks, are run again first; the session cannot go on once a frame
+// fails to be run again. It does nothing while the session is stalled.
+func (s *Session) Advance(keys [16]bool) error {
+	if start := s.replayFrom(); start != -1 {
+		frame := s.frame
+		if err := s.vm.LoadState(s.states[start]); err != nil {
+			return fmt.Errorf("frame %d: unable to roll back: %w", start, err)
+		}
+		if s.rollback != -1 {
+			s.Rollbacks += frame - s.rollback
+		}
+		s.frame, s.rollback = start, -1
+		for s.frame < frame {
+			if err := s.runFrame(); err != nil {
+				return err
+			}
+		}
+	}
+	s.checkHashes()
+	if s.Stalled() {
+		return nil
+	}
+	input := Message{Type: Input, Frame: s.frame + s.delay, Keys: packKeys(keys)}
+	s.local[input.Frame] = input.Keys
+	s.send(input)
+	return s.runFrame()
+}
+
+// checkHashes sends the hashes of the states that can no longer be rolled
+// back, and forgets what will no longer be needed.
+func (s *Session) checkHashes() {
+	for s.nextHash < s.frame && s.nextHash <= s.confirmed {
+		state := s.states[s.nextHash]
+		hash := strconv.FormatUint(state.Hash(), 16)
+		s.hashes[s.nextHash] = hash
+		s.send(Message{Type: Hash, Frame: s.nextHash, Hash: hash})
+		s.nextHash += HashInterval
+	}
+	s.compareHashes()
+	for f := range s.states {
+		if f < s.confirmed && f < s.nextHash && f < s.hooked {
+			delete(s.states, f)
+			delete(s.local, f)
+			delete(s.predicted, f)
+		}
+	}
+	for f := range s.remote {
+		if f < s.confirmed && f < s.frame {
+			delete(s.remote, f)
+		}
+	}
+}
+
+func (s *Session) compareHashes() {
+	for f, hash := range s.hashes {
+		peerHash, ok := s.peerHashes[f]
+		if !ok {
+			continue
+		}
+		if hash != peerHash && (s.Desync == -1 || f < s.Desync) {
+			s.Desync = f
+		}
+		delete(s.hashes, f)
+		delete(s.peerHashes, f)
+	}
+}
@@ -0,0 +1,185 @@
+package netplay
+
+import (
+	"testing"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+// player 1 moves V1 with key 1, player 2 moves V2 with key C, and both are
+// jostled by random numbers
+var game = []byte{
+	0x63, 0x01, // LD V3, 1
+	0x64, 0x0C, // LD V4, C
+	0xE3, 0xA1, // SKNP V3
+	0x71, 0x01, // ADD V1, 1
+	0xE4, 0xA1, // SKNP V4
+	0x72, 0x01, // ADD V2, 1
+	0xC5, 0x03, // RND V5, 3
+	0x80, 0x54, // ADD V0, V5
+	0x12, 0x04, // JP 204
+}
+
+type machine struct {
+	vm      chip8.Vm
+	session *Session
+	inbox   []Message // the messages in flight to this machine
+	arrival []int     // the frames they arrive at
+}
+
+// play runs two sessions whose messages take latency frames to arrive; each
+// player holds their key in the frames told by press, on a VM set up by setup
+// if not nil.
+func play(t *testing.T, delay, latency, frames int, press func(player, frame int) bool, setup func(player int, vm *chip8.Vm)) [2]*machine {
+	machines := [2]*machine{}
+	for i := range machines {
+		m := &machine{}
+		m.vm, _ = chip8.NewVm(game, nil)
+		m.vm.Seed(42)
+		if setup != nil {
+			setup(i, &m.vm)
+		}
+		machines[i] = m
+	}
+	now := 0
+	for i, m := range machines {
+		other := machines[1-i]
+		m.session = NewSession(&m.vm, chip8.RunParams{InstCount: 8}, delay, func(msg Message) {
+			other.inbox = append(other.inbox, msg)
+			other.arrival = append(other.arrival, now+latency)
+		})
+	}
+	keys := [2]byte{0x1, 0xC}
+	for now = 0; now < frames+2*latency+MaxRollback; now++ {
+		for i, m := range machines {
+			for len(m.inbox) > 0 && m.arrival[0] <= now {
+				m.session.Receive(m.inbox[0])
+				m.inbox, m.arrival = m.inbox[1:], m.arrival[1:]
+			}
+			held := [16]bool{}
+			held[keys[i]] = press(i, m.session.Frame())
+			if m.session.Frame() < frames {
+				if err := m.session.Advance(held); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	for _, m := range machines {
+		for _, msg := range m.inbox {
+			m.session.Receive(msg)
+		}
+		m.session.Advance([16]bool{}) // run the last rollbacks
+	}
+	return machines
+}
+
+func TestLockstep(t *testing.T) {
+	press := func(player, frame int) bool { return (frame/7+player)%3 == 0 }
+	for _, c := range []struct{ delay, latency int }{{2, 0}, {2, 2}, {0, 5}, {3, 12}} {
+		m := play(t, c.delay, c.latency, 200, press, nil)
+		a, b := m[0].vm.SaveState(), m[1].vm.SaveState()
+		if a.Hash() != b.Hash() {
+			t.Errorf("Lockstep err; delay %d, latency %d: states differ, V0-V2: %x, %x", c.delay, c.latency, a.Regs[:3], b.Regs[:3])
+		}
+		if a.Regs[1] == 0 || a.Regs[2] == 0 {
+			t.Errorf("Lockstep err; delay %d, latency %d: keys not held: %x", c.delay, c.latency, a.Regs[:3])
+		}
+		rollbacks := m[0].session.Rollbacks + m[1].session.Rollbacks
+		if (c.latency > c.delay) != (rollbacks > 0) {
+			t.Errorf("Lockstep err; delay %d, latency %d: %d rollbacks", c.delay, c.latency, rollbacks)
+		}
+		if m[0].session.Desync != -1 || m[1].session.Desync != -1 {
+			t.Errorf("Lockstep err; delay %d, latency %d: desync at %d, %d", c.delay, c.latency, m[0].session.Desync, m[1].session.Desync)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	press := func(player, frame int) bool { return (frame/7+player)%3 == 0 }
+	record := func(states *[]uint64) func(vm *chip8.Vm) {
+		return func(vm *chip8.Vm) {
+			state := vm.SaveState()
+			*states = append(*states, state.Hash())
+		}
+	}
+
+	// the states at the end of the frames run without netplay
+	io := &chip8.HeadlessIO{}
+	vm, _ := chip8.NewVm(game, io)
+	vm.Seed(42)
+	want := []uint64{}
+	vm.OnFrame(record(&want))
+	for frame := 0; frame < 250; frame++ {
+		io.Keys = [16]bool{0x1: press(0, frame), 0xC: press(1, frame)}
+		vm.RunFrame(chip8.RunParams{InstCount: 8})
+	}
+
+	seen := [2][]uint64{}
+	m := play(t, 0, 5, 200, press, func(player int, vm *chip8.Vm) {
+		vm.OnFrame(record(&seen[player]))
+	})
+	if m[0].session.Rollbacks == 0 {
+		t.Fatal("Hooks err; no rollback")
+	}
+	for player, states := range seen {
+		if len(states) < 200 {
+			t.Errorf("Hooks err; player %d: hooks called for %d frames", player, len(states))
+		}
+		for frame, hash := range states {
+			if hash != want[frame] {
+				t.Errorf("Hooks err; player %d: hooks called for a mispredicted frame %d", player, frame)
+				break
+			}
+		}
+	}
+}
+
+func TestStall(t *testing.T) {
+	vm, _ := chip8.NewVm(game, nil)
+	s := NewSession(&vm, chip8.RunParams{InstCount: 8}, 2, func(Message) {})
+	for i := 0; i < 100; i++ {
+		s.Advance([16]bool{})
+	}
+	if !s.Stalled() || s.Frame() != 2+MaxRollback {
+		t.Errorf("Stall err; stalled %v at frame %d", s.Stalled(), s.Frame())
+	}
+}
+
+func TestDesync(t *testing.T) {
+	vms := [2]chip8.Vm{}
+	sessions := [2]*Session{}
+	for i := range vms {
+		vms[i], _ = chip8.NewVm(game, nil)
+	}
+	for i := range sessions {
+		other := &sessions[1-i]
+		sessions[i] = NewSession(&vms[i], chip8.RunParams{InstCount: 8}, 1, func(msg Message) {
+			(*other).Receive(msg)
+		})
+	}
+	for frame := 0; frame < HashInterval+5; frame++ {
+		if frame == 10 {
+			vms[1].Mem[0x300] = 1 // a cheat applied on one machine only
+		}
+		for _, s := range sessions {
+			s.Advance([16]bool{})
+		}
+	}
+	if sessions[0].Desync != HashInterval || sessions[1].Desync != HashInterval {
+		t.Errorf("Desync err; desync at %d, %d", sessions[0].Desync, sessions[1].Desync)
+	}
+}
+
+func TestRollbackError(t *testing.T) {
+	vm, _ := chip8.NewVm(game, nil)
+	s := NewSession(&vm, chip8.RunParams{InstCount: 8}, 0, func(Message) {})
+	for i := 0; i < 5; i++ {
+		s.Advance([16]bool{})
+	}
+	s.states[0] = chip8.State{} // a state the VM cannot resume from
+	s.Receive(Message{Type: Input, Frame: 0, Keys: 1})
+	if err := s.Advance([16]bool{}); err == nil {
+		t.Error("Rollback err; invalid state accepted")
+	}
+}
@@ -0,0 +1,596 @@
+// Package octo assembles programs written in Octo
+// (https://github.com/JohnEarnest/Octo), the high-level assembly language most
+// modern CHIP-8 programs are distributed in.
+//
+// The classic CHIP-8 and SUPER-CHIP instructions, labels, constants, aliases,
+// conditionals, loops and the `:org`, `:byte`, `:unpack`, `:next` and `:call`
+// directives are supported. Macros, `:calc` expressions, string modes and the
+// XO-CHIP extensions are not.
+package octo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The address programs are loaded at
+const start = 0x200
+
+type token struct {
+	text string
+	line int
+}
+
+type fixupKind int
+
+const (
+	fixupAddr   fixupKind = iota // the low 12 bits of an instruction
+	fixupUnpack                  // the immediates of the two instructions emitted by :unpack
+	fixupByte                    // a single byte
+)
+
+type fixup struct {
+	kind   fixupKind
+	pos    int
+	label  string
+	nibble byte
+	line   int
+}
+
+type assembler struct {
+	tokens []token
+	pos    int
+	rom    []byte
+	addr   int // the address the next byte is written to
+
+	labels  map[string]int
+	consts  map[string]int
+	aliases map[string]byte
+	fixups  []fixup
+	loops   [][]int // positions of the pending `while` jumps of each nested loop; the first one is the loop start
+	ifs     []int   // positions of the pending jumps of `if ... begin` blocks
+	nextLbl string  // the label set by :next, bound to the byte after the next instruction's first byte
+}
+
+// Error is returned when a program cannot be assembled.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+func tokenize(source string) []token {
+	tokens := []token{}
+	for i, line := range strings.Split(source, "\n") {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		for _, field := range strings.Fields(line) {
+			tokens = append(tokens, token{text: field, line: i + 1})
+		}
+	}
+	return tokens
+}
+
+// Assemble compiles Octo source code into a ROM. Execution starts at the
+// `main` label.
+func Assemble(source string) (rom []byte, err error) {
+	a := &assembler{
+		tokens:  tokenize(source),
+		addr:    start,
+		labels:  map[string]int{},
+		consts:  map[string]int{},
+		aliases: map[string]byte{},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			rom, err = nil, e
+		}
+	}()
+
+	// reserve room for a jump to main
+	a.emit(0x10, 0x00)
+	a.fixups = append(a.fixups, fixup{kind: fixupAddr, pos: 0, label: "main"})
+	for a.pos < len(a.tokens) {
+		a.statement()
+	}
+	if len(a.loops) > 0 {
+		a.fail("missing 'again'")
+	}
+	if len(a.ifs) > 0 {
+		a.fail("missing 'end'")
+	}
+	if _, ok := a.labels["main"]; !ok {
+		a.fail("missing 'main' label")
+	}
+	a.resolve()
+	return a.rom, nil
+}
+
+func (a *assembler) line() int {
+	if a.pos == 0 || len(a.tokens) == 0 {
+		return 1
+	}
+	if a.pos > len(a.tokens) {
+		return a.tokens[len(a.tokens)-1].line
+	}
+	return a.tokens[a.pos-1].line
+}
+
+func (a *assembler) fail(format string, args ...any) {
+	panic(&Error{Line: a.line(), Msg: fmt.Sprintf(format, args...)})
+}
+
+func (a *assembler) next() string {
+	if a.pos >= len(a.tokens) {
+		a.pos++
+		a.fail("unexpected end of program")
+	}
+	a.pos++
+	return a.tokens[a.pos-1].text
+}
+
+func (a *assembler) expect(text string) {
+	if tok := a.next(); tok != text {
+		a.fail("expected '%s', found '%s'", text, tok)
+	}
+}
+
+func (a *assembler) emitByte(b byte) {
+	offset := a.addr - start
+	if offset < 0 {
+		a.fail("address %#x is below the start of the program", a.addr)
+	}
+	if offset >= 0xE00 {
+		a.fail("program exceeds the available memory")
+	}
+	for len(a.rom) <= offset {
+		a.rom = append(a.rom, 0)
+	}
+	a.rom[offset] = b
+	a.addr++
+}
+
+func (a *assembler) emit(b1, b2 byte) {
+	a.emitByte(b1)
+	if a.nextLbl != "" {
+		a.define(a.nextLbl, a.addr)
+		a.nextLbl = ""
+	}
+	a.emitByte(b2)
+}
+
+func (a *assembler) define(name string, value int) {
+	if _, ok := a.labels[name]; ok {
+		a.fail("label '%s' is already defined", name)
+	}
+	a.labels[name] = value
+}
+
+// emitAddr emits an instruction whose 12 lowest bits are an address that may
+// refer to a label not defined yet.
+func (a *assembler) emitAddr(op byte, tok string) {
+	pos := a.addr - start
+	if n, ok := a.number(tok); ok {
+		a.emit(op|byte(n>>8&0xF), byte(n))
+		return
+	}
+	a.emit(op, 0)
+	a.fixups = append(a.fixups, fixup{kind: fixupAddr, pos: pos, label: tok, line: a.line()})
+}
+
+func (a *assembler) resolve() {
+	for _, f := range a.fixups {
+		n, ok := a.labels[f.label]
+		if !ok {
+			panic(&Error{Line: f.line, Msg: fmt.Sprintf("undefined name '%s'", f.label)})
+		}
+		switch f.kind {
+		case fixupAddr:
+			if n > 0xFFF {
+				panic(&Error{Line: f.line, Msg: fmt.Sprintf("address %#x of '%s' is out of range", n, f.label)})
+			}
+			a.rom[f.pos] |= byte(n >> 8 & 0xF)
+			a.rom[f.pos+1] = byte(n)
+		case fixupUnpack:
+			a.rom[f.pos+1] = f.nibble<<4 | byte(n>>8&0xF)
+			a.rom[f.pos+3] = byte(n)
+		case fixupByte:
+			a.rom[f.pos] = byte(n)
+		}
+	}
+}
+
+// number parses a numeric literal, a constant or a label defined earlier.
+func (a *assembler) number(tok string) (int, bool) {
+	if n, ok := a.consts[tok]; ok {
+		return n, true
+	}
+	if n, ok := a.labels[tok]; ok {
+		return n, true
+	}
+	negative := strings.HasPrefix(tok, "-")
+	digits := strings.TrimPrefix(tok, "-")
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x"), strings.HasPrefix(digits, "0X"):
+		base, digits = 16, digits[2:]
+	case strings.HasPrefix(digits, "0b"), strings.HasPrefix(digits, "0B"):
+		base, digits = 2, strings.NewReplacer(".", "0").Replace(digits[2:])
+	}
+	n, err := strconv.ParseInt(digits, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	if negative {
+		n = -n
+	}
+	return int(n), true
+}
+
+func (a *assembler) value(tok string) int {
+	n, ok := a.number(tok)
+	if !ok {
+		a.fail("expected a number, found '%s'", tok)
+	}
+	return n
+}
+
+func (a *assembler) byteValue(tok string) byte {
+	n := a.value(tok)
+	if n < -128 || n > 255 {
+		a.fail("value %d does not fit in a byte", n)
+	}
+	return byte(n)
+}
+
+func (a *assembler) register(tok string) (byte, bool) {
+	if r, ok := a.aliases[tok]; ok {
+		return r, true
+	}
+	lower := strings.ToLower(tok)
+	if len(lower) == 2 && lower[0] == 'v' {
+		if r, err := strconv.ParseUint(lower[1:], 16, 8); err == nil {
+			return byte(r), true
+		}
+	}
+	return 0, false
+}
+
+func (a *assembler) mustRegister(tok string) byte {
+	r, ok := a.register(tok)
+	if !ok {
+		a.fail("expected a register, found '%s'", tok)
+	}
+	return r
+}
+
+// isName reports if a token can be used as a label, constant or alias.
+func isName(tok string) bool {
+	if tok == "" || strings.ContainsAny(tok[:1], "0123456789-") {
+		return false
+	}
+	switch tok {
+	case ":", ";", ":=", "+=", "-=", "=-", "|=", "&=", "^=", ">>=", "<<=", "==", "!=", "<", ">", "<=", ">=":
+		return false
+	}
+	return true
+}
+
+func (a *assembler) name() string {
+	tok := a.next()
+	if !isName(tok) {
+		a.fail("invalid name '%s'", tok)
+	}
+	return tok
+}
+
+func (a *assembler) statement() {
+	tok := a.next()
+	switch tok {
+	case ":":
+		a.define(a.name(), a.addr)
+	case ":const":
+		name := a.name()
+		a.consts[name] = a.value(a.next())
+	case ":alias":
+		name := a.name()
+		a.aliases[name] = a.mustRegister(a.next())
+	case ":org":
+		a.addr = a.value(a.next())
+	case ":byte":
+		tok := a.next()
+		if _, ok := a.number(tok); ok || !isName(tok) {
+			a.emitByte(a.byteValue(tok))
+			return
+		}
+		a.fixups = append(a.fixups, fixup{kind: fixupByte, pos: a.addr - start, label: tok, line: a.line()})
+		a.emitByte(0)
+	case ":unpack":
+		nibble := a.value(a.next())
+		label := a.next()
+		if n, ok := a.number(label); ok {
+			a.emit(0x60, byte(nibble<<4|n>>8&0xF))
+			a.emit(0x61, byte(n))
+			return
+		}
+		a.fixups = append(a.fixups, fixup{kind: fixupUnpack, pos: a.addr - start, label: label, nibble: byte(nibble), line: a.line()})
+		a.emit(0x60, 0)
+		a.emit(0x61, 0)
+	case ":next":
+		a.nextLbl = a.name()
+	case ":call":
+		a.emitAddr(0x20, a.next())
+	case ":breakpoint", ":proto":
+		a.next() // only meaningful to Octo's debugger and older compilers
+	case ":monitor":
+		a.next()
+		a.next()
+	case ":macro", ":calc", ":stringmode", ":assert", ":pointer", ":nextproto":
+		a.fail("'%s' is not supported", tok)
+	case "clear":
+		a.emit(0x00, 0xE0)
+	case "return", ";":
+		a.emit(0x00, 0xEE)
+	case "exit":
+		a.emit(0x00, 0xFD)
+	case "lores":
+		a.emit(0x00, 0xFE)
+	case "hires":
+		a.emit(0x00, 0xFF)
+	case "scroll-down":
+		a.emit(0x00, 0xC0|a.byteValue(a.next())&0xF)
+	case "scroll-left":
+		a.emit(0x00, 0xFC)
+	case "scroll-right":
+		a.emit(0x00, 0xFB)
+	case "jump":
+		a.emitAddr(0x10, a.next())
+	case "jump0":
+		a.emitAddr(0xB0, a.next())
+	case "sprite":
+		x := a.mustRegister(a.next())
+		y := a.mustRegister(a.next())
+		n := a.byteValue(a.next())
+		a.emit(0xD0|x, y<<4|n&0xF)
+	case "bcd":
+		a.emit(0xF0|a.mustRegister(a.next()), 0x33)
+	case "save":
+		a.emit(0xF0|a.mustRegister(a.next()), 0x55)
+	case "load":
+		a.emit(0xF0|a.mustRegister(a.next()), 0x65)
+	case "saveflags":
+		a.emit(0xF0|a.mustRegister(a.next()), 0x75)
+	case "loadflags":
+		a.emit(0xF0|a.mustRegister(a.next()), 0x85)
+	case "delay", "buzzer":
+		a.expect(":=")
+		op := byte(0x15)
+		if tok == "buzzer" {
+			op = 0x18
+		}
+		a.emit(0xF0|a.mustRegister(a.next()), op)
+	case "i":
+		a.indexStatement()
+	case "if":
+		a.ifStatement()
+	case "else":
+		if len(a.ifs) == 0 {
+			a.fail("'else' without 'if ... begin'")
+		}
+		pending := a.ifs[len(a.ifs)-1]
+		jump := a.addr - start
+		a.emit(0x10, 0x00)
+		a.patchJump(pending, a.addr)
+		a.ifs[len(a.ifs)-1] = jump
+	case "end":
+		if len(a.ifs) == 0 {
+			a.fail("'end' without 'if ... begin'")
+		}
+		a.patchJump(a.ifs[len(a.ifs)-1], a.addr)
+		a.ifs = a.ifs[:len(a.ifs)-1]
+	case "loop":
+		a.loops = append(a.loops, []int{a.addr})
+	case "while":
+		if len(a.loops) == 0 {
+			a.fail("'while' without 'loop'")
+		}
+		a.condition(true)
+		loop := len(a.loops) - 1
+		a.loops[loop] = append(a.loops[loop], a.addr-start)
+		a.emit(0x10, 0x00)
+	case "again":
+		if len(a.loops) == 0 {
+			a.fail("'again' without 'loop'")
+		}
+		loop := a.loops[len(a.loops)-1]
+		a.loops = a.loops[:len(a.loops)-1]
+		a.emit(0x10|byte(loop[0]>>8&0xF), byte(loop[0]))
+		for _, pos := range loop[1:] {
+			a.patchJump(pos, a.addr)
+		}
+	default:
+		if r, ok := a.register(tok); ok {
+			a.registerStatement(r)
+			return
+		}
+		if n, ok := a.number(tok); ok {
+			if _, isLabel := a.labels[tok]; isLabel {
+				a.emit(0x20|byte(n>>8&0xF), byte(n))
+				return
+			}
+			a.emitByte(a.byteValue(tok))
+			return
+		}
+		if isName(tok) && !strings.HasPrefix(tok, ":") {
+			a.emitAddr(0x20, tok) // calling a subroutine defined later
+			return
+		}
+		a.fail("unexpected '%s'", tok)
+	}
+}
+
+func (a *assembler) patchJump(pos, addr int) {
+	a.rom[pos] = 0x10 | byte(addr>>8&0xF)
+	a.rom[pos+1] = byte(addr)
+}
+
+func (a *assembler) indexStatement() {
+	op := a.next()
+	switch op {
+	case ":=":
+		tok := a.next()
+		switch tok {
+		case "hex":
+			a.emit(0xF0|a.mustRegister(a.next()), 0x29)
+		case "bighex":
+			a.emit(0xF0|a.mustRegister(a.next()), 0x30)
+		default:
+			a.emitAddr(0xA0, tok)
+		}
+	case "+=":
+		a.emit(0xF0|a.mustRegister(a.next()), 0x1E)
+	default:
+		a.fail("unexpected '%s' after 'i'", op)
+	}
+}
+
+func (a *assembler) registerStatement(x byte) {
+	op := a.next()
+	tok := a.next()
+	y, isReg := a.register(tok)
+	switch op {
+	case ":=":
+		switch {
+		case isReg:
+			a.emit(0x80|x, y<<4)
+		case tok == "delay":
+			a.emit(0xF0|x, 0x07)
+		case tok == "key":
+			a.emit(0xF0|x, 0x0A)
+		case tok == "random":
+			a.emit(0xC0|x, a.byteValue(a.next()))
+		default:
+			a.emit(0x60|x, a.byteValue(tok))
+		}
+	case "+=":
+		if isReg {
+			a.emit(0x80|x, y<<4|0x4)
+		} else {
+			a.emit(0x70|x, a.byteValue(tok))
+		}
+	case "-=":
+		if isReg {
+			a.emit(0x80|x, y<<4|0x5)
+		} else {
+			a.emit(0x70|x, byte(-int(a.byteValue(tok))))
+		}
+	default:
+		ops := map[string]byte{"|=": 0x1, "&=": 0x2, "^=": 0x3, ">>=": 0x6, "=-": 0x7, "<<=": 0xE}
+		z, ok := ops[op]
+		if !ok {
+			a.fail("unexpected '%s' after register", op)
+		}
+		if !isReg {
+			a.fail("expected a register, found '%s'", tok)
+		}
+		a.emit(0x80|x, y<<4|z)
+	}
+}
+
+func (a *assembler) ifStatement() {
+	// look past the condition to know if it guards a statement or a block
+	length := 3
+	if a.pos+1 < len(a.tokens) && (a.tokens[a.pos+1].text == "key" || a.tokens[a.pos+1].text == "-key") {
+		length = 2
+	}
+	keyword := ""
+	if a.pos+length < len(a.tokens) {
+		keyword = a.tokens[a.pos+length].text
+	}
+	switch keyword {
+	case "then":
+		a.condition(false)
+		a.next()
+	case "begin":
+		// skip the jump past the block when the condition holds
+		a.condition(true)
+		a.next()
+		a.ifs = append(a.ifs, a.addr-start)
+		a.emit(0x10, 0x00)
+	default:
+		a.fail("expected 'then' or 'begin' after condition")
+	}
+}
+
+// condition emits the instructions that skip the next one unless the
+// condition holds, or if it holds when negated is true.
+func (a *assembler) condition(negated bool) {
+	x := a.mustRegister(a.next())
+	op := a.next()
+	if op == "key" || op == "-key" {
+		if (op == "key") != negated {
+			a.emit(0xE0|x, 0xA1) // skip if not pressed
+		} else {
+			a.emit(0xE0|x, 0x9E)
+		}
+		return
+	}
+
+	tok := a.next()
+	y, isReg := a.register(tok)
+	switch op {
+	case "==", "!=":
+		// skip unless equal means skipping if not equal
+		skipIfEqual := (op == "!=") != negated
+		switch {
+		case isReg && skipIfEqual:
+			a.emit(0x50|x, y<<4)
+		case isReg:
+			a.emit(0x90|x, y<<4)
+		case skipIfEqual:
+			a.emit(0x30|x, a.byteValue(tok))
+		default:
+			a.emit(0x40|x, a.byteValue(tok))
+		}
+	case "<", ">", "<=", ">=":
+		// Compute VF = (p >= q) through a subtraction, then test VF
+		p, q := "x", "y"
+		if op == ">" || op == "<=" {
+			p, q = q, p
+		}
+		wantFlag := byte(1) // p >= q holds when the subtraction does not borrow
+		if op == "<" || op == ">" {
+			wantFlag = 0
+		}
+		switch {
+		case isReg && p == "x":
+			a.emit(0x8F, x<<4)
+			a.emit(0x8F, y<<4|0x5)
+		case isReg:
+			a.emit(0x8F, y<<4)
+			a.emit(0x8F, x<<4|0x5)
+		case p == "x":
+			a.emit(0x6F, a.byteValue(tok))
+			a.emit(0x8F, x<<4|0x7)
+		default:
+			a.emit(0x6F, a.byteValue(tok))
+			a.emit(0x8F, x<<4|0x5)
+		}
+		if negated {
+			a.emit(0x3F, wantFlag)
+		} else {
+			a.emit(0x4F, wantFlag)
+		}
+	default:
+		a.fail("unexpected '%s' in condition", op)
+	}
+}
@@ -0,0 +1,86 @@
+package octo
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	source := `
+# draws a face until a key is pressed
+:const SIZE 5
+:alias x v1
+
+: face
+	0b.1111.. 0xBD 0x81 0x66 0x3C
+
+: main
+	clear
+	x := 10
+	v2 := 0
+	i := face
+	loop
+		sprite x v2 SIZE
+		x += 1
+		if x == 20 then x := 0
+		if v0 key begin
+			jump done
+		else
+			v2 := random 0x1F
+		end
+		while x != 5
+	again
+: done
+	v0 := key
+	if v0 > 3 then return
+	jump done
+`
+	expected := []byte{
+		0x12, 0x07, // jump main
+		0x3C, 0xBD, 0x81, 0x66, 0x3C, // face
+		0x00, 0xE0, // clear
+		0x61, 0x0A, // x := 10
+		0x62, 0x00, // v2 := 0
+		0xA2, 0x02, // i := face
+		0xD1, 0x25, // sprite x v2 SIZE
+		0x71, 0x01, // x += 1
+		0x41, 0x14, // if x == 20 then
+		0x61, 0x00, // x := 0
+		0xE0, 0x9E, // if v0 key begin
+		0x12, 0x1F, // jump to else
+		0x12, 0x27, // jump done
+		0x12, 0x21, // else
+		0xC2, 0x1F, // v2 := random 0x1F
+		0x41, 0x05, // while x != 5
+		0x12, 0x27, // jump past again
+		0x12, 0x0F, // again
+		0xF0, 0x0A, // v0 := key
+		0x6F, 0x03, // if v0 > 3 then
+		0x8F, 0x05,
+		0x4F, 0x00,
+		0x00, 0xEE, // return
+		0x12, 0x27, // jump done
+	}
+	rom, err := Assemble(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rom, expected) {
+		t.Errorf("Assemble err;\nExpected: % x\nReceived: % x", expected, rom)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	for source, msg := range map[string]string{
+		": main\n  v0 := 0\n  jump nowhere": "line 3: undefined name 'nowhere'",
+		": main\n  loop\n    v0 += 1":       "line 3: missing 'again'",
+		"v0 := 1":                           "line 1: missing 'main' label",
+		": main\n  :macro foo { v0 := 1 }":  "line 2: ':macro' is not supported",
+		": main\n  v0 := 256":               "line 2: value 256 does not fit in a byte",
+	} {
+		_, err := Assemble(source)
+		if err == nil || err.Error() != msg {
+			t.Errorf("Assemble error err; Expected: %s, Received: %v", msg, err)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package chip8
+
+// Quirks toggle the behaviours that differ between the platforms CHIP-8
+// programs were written for.
+type Quirks struct {
+	VFReset  bool // 8xy1, 8xy2 and 8xy3 reset VF to 0
+	Memory   bool // Fx55 and Fx65 increment I
+	Shifting bool // 8xy6 and 8xyE shift Vx in place instead of shifting Vy into Vx
+	Jumping  bool // Bnnn jumps to nnn + Vx, x being the highest nibble of nnn, instead of nnn + V0
+	Clipping bool // sprites are clipped at the edges of the screen instead of wrapping around
+}
+
+// ChipQuirks are the quirks of the original COSMAC VIP interpreter.
+var ChipQuirks = Quirks{
+	VFReset:  true,
+	Memory:   true,
+	Clipping: true,
+}
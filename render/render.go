@@ -0,0 +1,217 @@
+// Package render converts the display of the VM into images, applying a
+// palette, scaling, a scanline overlay and phosphor persistence (ghosting).
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+// A Frame is a display buffer. Each pixel value is an index into the palette
+// so that buffers made of several bit planes can be rendered as well.
+type Frame interface {
+	Size() (w, h int)
+	At(x, y int) byte
+}
+
+type pixelsFrame chip8.Pixels
+
+func (p *pixelsFrame) Size() (int, int) {
+	return len(p[0]), len(p)
+}
+
+func (p *pixelsFrame) At(x, y int) byte {
+	return p[y][x]
+}
+
+// FromPixels returns the frame of the VM display.
+func FromPixels(pixels *chip8.Pixels) Frame {
+	return (*pixelsFrame)(pixels)
+}
+
+type planesFrame []Frame
+
+func (p planesFrame) Size() (int, int) {
+	return p[0].Size()
+}
+
+func (p planesFrame) At(x, y int) byte {
+	var v byte
+	for i, plane := range p {
+		if plane.At(x, y) != 0 {
+			v |= 1 << i
+		}
+	}
+	return v
+}
+
+// Planes combines frames of the same size into one; the value of a pixel has
+// its nth bit set when the pixel is lit in the nth plane.
+func Planes(planes ...Frame) Frame {
+	return planesFrame(planes)
+}
+
+// A Palette maps pixel values to colours; the first colour is the background.
+type Palette []color.RGBA
+
+var (
+	Classic = Palette{{0xFF, 0xFF, 0xFF, 0xFF}, {0x00, 0x00, 0x00, 0xFF}}
+	Inverse = Palette{{0x00, 0x00, 0x00, 0xFF}, {0xFF, 0xFF, 0xFF, 0xFF}}
+	Green   = Palette{{0x0A, 0x1A, 0x0A, 0xFF}, {0x33, 0xFF, 0x66, 0xFF}}
+	Amber   = Palette{{0x1A, 0x10, 0x00, 0xFF}, {0xFF, 0xB0, 0x00, 0xFF}}
+	Octo    = Palette{{0x99, 0x66, 0x00, 0xFF}, {0xFF, 0xCC, 0x00, 0xFF}, {0xFF, 0x66, 0x00, 0xFF}, {0x66, 0x22, 0x00, 0xFF}}
+)
+
+// Palettes are the built-in palettes by name.
+var Palettes = map[string]Palette{
+	"classic": Classic,
+	"inverse": Inverse,
+	"green":   Green,
+	"amber":   Amber,
+	"octo":    Octo,
+}
+
+// ParsePalette creates a palette from CSS hex colours such as `#FFCC00` or
+// `#FC0`, as found in the ROM database and Octo cartridges.
+func ParsePalette(colors []string) (Palette, error) {
+	palette := make(Palette, 0, len(colors))
+	for _, c := range colors {
+		hex := strings.TrimPrefix(c, "#")
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != 6 {
+			return nil, fmt.Errorf("invalid colour %q", c)
+		}
+		palette = append(palette, color.RGBA{byte(v >> 16), byte(v >> 8), byte(v), 0xFF})
+	}
+	if len(palette) < 2 {
+		return nil, fmt.Errorf("a palette needs at least 2 colours")
+	}
+	return palette, nil
+}
+
+func (p Palette) color(v byte) color.RGBA {
+	if int(v) < len(p) {
+		return p[v]
+	}
+	return p[len(p)-1]
+}
+
+type Options struct {
+	Palette   Palette // Classic if empty
+	Scale     int     // the size of a display pixel in image pixels
+	Scanlines float64 // how much the last row of each scaled pixel row is darkened, from 0 to 1
+	Ghosting  int     // the number of frames an erased pixel takes to fade out
+}
+
+// A Renderer turns successive frames into an image. It keeps the state of the
+// previous frames to fade erased pixels out.
+type Renderer struct {
+	opts   Options
+	img    *image.RGBA
+	values []byte    // the value of each pixel when it was last lit
+	glow   []float64 // the intensity of each pixel, 1 when lit
+	drawn  []color.RGBA
+}
+
+func New(opts Options) *Renderer {
+	if len(opts.Palette) == 0 {
+		opts.Palette = Classic
+	}
+	if opts.Scale < 1 {
+		opts.Scale = 1
+	}
+	return &Renderer{opts: opts}
+}
+
+// SetOptions changes how the next frames are rendered.
+func (r *Renderer) SetOptions(opts Options) {
+	*r = *New(opts)
+}
+
+func (r *Renderer) Options() Options {
+	return r.opts
+}
+
+// Image returns the image the frames are rendered to.
+func (r *Renderer) Image() *image.RGBA {
+	return r.img
+}
+
+func blend(bg, fg color.RGBA, t float64) color.RGBA {
+	mix := func(a, b byte) byte {
+		return byte(float64(a) + (float64(b)-float64(a))*t + 0.5)
+	}
+	return color.RGBA{mix(bg.R, fg.R), mix(bg.G, fg.G), mix(bg.B, fg.B), mix(bg.A, fg.A)}
+}
+
+// Render draws a frame and returns the area of the image that has changed.
+// Erased pixels keep fading out over the following frames, so a frame has to
+// be rendered for each display refresh even if the VM has not drawn anything.
+func (r *Renderer) Render(f Frame) image.Rectangle {
+	w, h := f.Size()
+	scale := r.opts.Scale
+	if r.img == nil || r.img.Bounds().Dx() != w*scale || r.img.Bounds().Dy() != h*scale {
+		r.img = image.NewRGBA(image.Rect(0, 0, w*scale, h*scale))
+		r.values = make([]byte, w*h)
+		r.glow = make([]float64, w*h)
+		r.drawn = make([]color.RGBA, w*h)
+		for i := range r.drawn {
+			r.drawn[i].A = 1 // any colour different from the palette's forces the first render
+		}
+	}
+
+	bg := r.opts.Palette[0]
+	fade := 1.0
+	if r.opts.Ghosting > 0 {
+		fade = 1 / float64(r.opts.Ghosting+1)
+	}
+	changed := image.Rectangle{}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			if v := f.At(x, y); v != 0 {
+				r.values[i] = v
+				r.glow[i] = 1
+			} else if r.glow[i] > 0 {
+				r.glow[i] -= fade
+				if r.glow[i] < 1e-9 {
+					r.glow[i] = 0
+				}
+			}
+
+			c := bg
+			if r.glow[i] > 0 {
+				c = blend(bg, r.opts.Palette.color(r.values[i]), r.glow[i])
+			}
+			if c == r.drawn[i] {
+				continue
+			}
+			r.drawn[i] = c
+			cell := image.Rect(x*scale, y*scale, (x+1)*scale, (y+1)*scale)
+			r.fill(cell, c)
+			changed = changed.Union(cell)
+		}
+	}
+	return changed
+}
+
+func (r *Renderer) fill(cell image.Rectangle, c color.RGBA) {
+	dark := blend(c, color.RGBA{0, 0, 0, c.A}, r.opts.Scanlines)
+	for y := cell.Min.Y; y < cell.Max.Y; y++ {
+		rc := c
+		if r.opts.Scanlines > 0 && r.opts.Scale > 1 && y == cell.Max.Y-1 {
+			rc = dark
+		}
+		for x := cell.Min.X; x < cell.Max.X; x++ {
+			r.img.SetRGBA(x, y, rc)
+		}
+	}
+}
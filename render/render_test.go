@@ -0,0 +1,72 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+func TestRender(t *testing.T) {
+	r := New(Options{Scale: 2, Ghosting: 1})
+	pixels := chip8.Pixels{}
+	pixels[1][3] = 1
+
+	changed := r.Render(FromPixels(&pixels))
+	if changed != image.Rect(0, 0, 128, 64) {
+		t.Errorf("Render err; changed: %v", changed)
+	}
+	if c := r.Image().RGBAAt(7, 3); c != Classic[1] {
+		t.Errorf("Render err; lit pixel: %v", c)
+	}
+	if c := r.Image().RGBAAt(5, 3); c != Classic[0] {
+		t.Errorf("Render err; unlit pixel: %v", c)
+	}
+
+	// an erased pixel fades out over the next frame
+	pixels[1][3] = 0
+	changed = r.Render(FromPixels(&pixels))
+	if changed != image.Rect(6, 2, 8, 4) {
+		t.Errorf("Render err; changed: %v", changed)
+	}
+	if c := r.Image().RGBAAt(7, 3); c != (color.RGBA{0x80, 0x80, 0x80, 0xFF}) {
+		t.Errorf("Render err; fading pixel: %v", c)
+	}
+	r.Render(FromPixels(&pixels))
+	if c := r.Image().RGBAAt(7, 3); c != Classic[0] {
+		t.Errorf("Render err; faded pixel: %v", c)
+	}
+	if changed = r.Render(FromPixels(&pixels)); !changed.Empty() {
+		t.Errorf("Render err; changed: %v", changed)
+	}
+}
+
+func TestEmptyPalette(t *testing.T) {
+	r := New(Options{Palette: Palette{}})
+	r.Render(FromPixels(&chip8.Pixels{}))
+	if c := r.Image().RGBAAt(0, 0); c != Classic[0] {
+		t.Errorf("Empty palette err; background: %v", c)
+	}
+}
+
+func TestPlanes(t *testing.T) {
+	plane1, plane2 := chip8.Pixels{}, chip8.Pixels{}
+	plane1[0][0], plane2[0][0], plane2[0][1] = 1, 1, 1
+
+	r := New(Options{Palette: Octo})
+	r.Render(Planes(FromPixels(&plane1), FromPixels(&plane2)))
+	if r.Image().RGBAAt(0, 0) != Octo[3] || r.Image().RGBAAt(1, 0) != Octo[2] {
+		t.Errorf("Planes err; %v, %v", r.Image().RGBAAt(0, 0), r.Image().RGBAAt(1, 0))
+	}
+}
+
+func TestParsePalette(t *testing.T) {
+	p, err := ParsePalette([]string{"#996600", "#FC0"})
+	if err != nil || p[0] != Octo[0] || p[1] != Octo[1] {
+		t.Errorf("ParsePalette err; %v, %v", p, err)
+	}
+	if _, err := ParsePalette([]string{"#000000", "red"}); err == nil {
+		t.Error("ParsePalette err; invalid colour accepted")
+	}
+}
@@ -0,0 +1,56 @@
+package render
+
+// A SpriteSheet is a frame laying out sprites read from memory in a grid,
+// one pixel apart, to view the graphics data of a program.
+type SpriteSheet struct {
+	Mem     []byte
+	Addr    int  // the address of the first sprite
+	Height  int  // the number of rows of each sprite, ignored for wide sprites
+	Wide    bool // 16x16 sprites of the SUPER-CHIP, 2 bytes per row
+	Count   int  // the number of sprites
+	Columns int  // the number of sprites per row of the sheet; 8 when zero
+}
+
+// SpriteSize returns the size of a sprite in pixels and in bytes.
+func (s SpriteSheet) SpriteSize() (w, h, size int) {
+	if s.Wide {
+		return 16, 16, 32
+	}
+	return 8, s.Height, s.Height
+}
+
+func (s SpriteSheet) columns() int {
+	cols := s.Columns
+	if cols <= 0 {
+		cols = 8
+	}
+	if s.Count < cols {
+		return s.Count
+	}
+	return cols
+}
+
+func (s SpriteSheet) Size() (int, int) {
+	w, h, _ := s.SpriteSize()
+	cols := s.columns()
+	if cols == 0 || h == 0 {
+		return 0, 0
+	}
+	rows := (s.Count + cols - 1) / cols
+	return cols*(w+1) - 1, rows*(h+1) - 1
+}
+
+func (s SpriteSheet) At(x, y int) byte {
+	w, h, size := s.SpriteSize()
+	col, px := x/(w+1), x%(w+1)
+	row, py := y/(h+1), y%(h+1)
+	sprite := row*s.columns() + col
+	if px == w || py == h || sprite >= s.Count {
+		return 0
+	}
+	addr := s.Addr + sprite*size + py*(w/8) + px/8
+	if addr < 0 || addr >= len(s.Mem) {
+		return 0
+	}
+	return s.Mem[addr] >> (7 - px%8) & 1
+}
@@ -0,0 +1,30 @@
+package render
+
+import "testing"
+
+func TestSpriteSheet(t *testing.T) {
+	mem := []byte{0x80, 0x01, 0xFF, 0x00, 0x81}
+	sheet := SpriteSheet{Mem: mem, Height: 2, Count: 3, Columns: 2}
+	expected := []string{
+		"#........########",
+		".......#.........",
+		".................",
+		"#......#.........", // the second row of the last sprite is out of memory
+		".................",
+	}
+	if w, h := sheet.Size(); w != len(expected[0]) || h != len(expected) {
+		t.Fatalf("Sprite sheet err; size: %dx%d", w, h)
+	}
+	for y, row := range expected {
+		for x, c := range row {
+			if lit := sheet.At(x, y) == 1; lit != (c == '#') {
+				t.Errorf("Sprite sheet err; pixel (%d, %d) lit: %v", x, y, lit)
+			}
+		}
+	}
+
+	wide := SpriteSheet{Mem: []byte{0x00, 0x01}, Wide: true, Count: 1}
+	if w, h := wide.Size(); w != 16 || h != 16 || wide.At(15, 0) != 1 || wide.At(7, 0) != 0 {
+		t.Errorf("Sprite sheet err; wide sprite %dx%d", w, h)
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/capture"
+	"github.com/bobbynarvy/chip8/loader"
+	"github.com/bobbynarvy/chip8/render"
+)
+
+// maxFrames bounds the frames run by a single request.
+const maxFrames = 60 * 60 * 10
+
+// API runs headless VMs, or sessions, on behalf of scripts driving the
+// emulator over HTTP:
+//
+//	POST   /api/sessions?name=pong.ch8&seed=1  create a session from the ROM in the body
+//	GET    /api/sessions                       list the sessions
+//	GET    /api/sessions/{id}                  the registers and status of a session
+//	DELETE /api/sessions/{id}                  delete a session
+//	POST   /api/sessions/{id}/frames           run {"Frames": 60, "Keys": [5]} holding keys
+//	GET    /api/sessions/{id}/memory?addr=0x200&len=16  read memory as bytes
+//	GET    /api/sessions/{id}/display.png?scale=4&palette=classic  the display
+//	GET    /api/sessions/{id}/state            take a save state
+//	PUT    /api/sessions/{id}/state            restore a save state
+//	GET    /api/sessions/{id}/stream           watch and play a session over WebSocket, see serveStream
+//	GET    /api/netplay/{room}                 join a netplay room over WebSocket, see serveRoom
+//	GET    /api/roms?q=pong                    search the ROM library, see Library
+//
+// Bodies are JSON, sent as application/json, except the ROMs, sent as
+// application/octet-stream. Responses are JSON unless stated otherwise;
+// errors are objects with an Error message.
+type API struct {
+	mu       sync.Mutex
+	sessions map[int]*session
+	nextID   int
+	netplay  netplayRooms
+
+	Library *Library // the ROMs served, if any
+	Origins []string // the origins of the other sites whose pages may open WebSockets, or "*" for all
+}
+
+type session struct {
+	mu     sync.Mutex
+	id     int
+	name   string
+	rom    loader.Rom
+	io     *chip8.HeadlessIO
+	vm     chip8.Vm
+	params chip8.RunParams
+	frames int
+	stream sessionStream
+}
+
+// SessionInfo is what a session reports about itself and its VM.
+type SessionInfo struct {
+	ID            int
+	Name          string
+	Title         string
+	Hash          string
+	Frames        int // the number of frames run
+	Done          bool
+	Halted        string
+	WaitingForKey bool
+	Pc            uint16
+	I             uint16
+	Sp            byte
+	DT, ST        byte
+	Regs          [16]byte
+	Stack         [16]uint16
+}
+
+func (s *session) info() SessionInfo {
+	return SessionInfo{
+		ID:            s.id,
+		Name:          s.name,
+		Title:         s.rom.Metadata.Title,
+		Hash:          s.rom.Metadata.Hash,
+		Frames:        s.frames,
+		Done:          s.vm.Done,
+		Halted:        s.vm.Halted.String(),
+		WaitingForKey: s.vm.WaitingForKey,
+		Pc:            s.vm.Pc,
+		I:             s.vm.I,
+		Sp:            s.vm.Sp,
+		DT:            s.vm.DT,
+		ST:            s.vm.ST,
+		Regs:          s.vm.Regs,
+		Stack:         s.vm.Stack,
+	}
+}
+
+func NewAPI() *API {
+	return &API{sessions: map[int]*session{}}
+}
+
+// Close disconnects the WebSocket clients of the sessions and netplay rooms,
+// which the server does not track once their connections are taken over,
+// e.g. when it shuts down.
+func (a *API) Close() {
+	a.mu.Lock()
+	sessions := make([]*session, 0, len(a.sessions))
+	for _, s := range a.sessions {
+		sessions = append(sessions, s)
+	}
+	a.mu.Unlock()
+	for _, s := range sessions {
+		s.mu.Lock()
+		s.closeStream(nil)
+		s.mu.Unlock()
+	}
+	a.netplay.close()
+}
+
+// apiError is an error answered with a status code.
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e apiError) Error() string {
+	return e.msg
+}
+
+func errorf(status int, format string, args ...any) error {
+	return apiError{status, fmt.Sprintf(format, args...)}
+}
+
+// checkContentType refuses a body that is not of a media type; the pages of
+// other sites can only send forms and plain text without the server agreeing
+// to it first, which would otherwise let any of them drive the sessions.
+func checkContentType(r *http.Request, mediaType string) error {
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t != mediaType {
+		return errorf(http.StatusUnsupportedMediaType, "expected a body of type %s", mediaType)
+	}
+	return nil
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w = &responseWriter{ResponseWriter: w}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/")
+	parts := strings.Split(path, "/")
+	var err error
+	switch {
+	case parts[0] == "netplay" && len(parts) == 2:
+		err = a.netplay.serveRoom(w, r, parts[1], a.Origins)
+	case parts[0] == "roms":
+		err = a.Library.serveLibrary(w, r, strings.Join(parts[1:], "/"))
+	case parts[0] != "sessions":
+		err = errorf(http.StatusNotFound, "unknown resource %s", r.URL.Path)
+	case len(parts) == 1:
+		err = a.serveSessions(w, r)
+	default:
+		id, _ := strconv.Atoi(parts[1])
+		a.mu.Lock()
+		s, ok := a.sessions[id]
+		a.mu.Unlock()
+		if !ok {
+			err = errorf(http.StatusNotFound, "unknown session %s", parts[1])
+			break
+		}
+		if len(parts) == 3 && parts[2] == "stream" {
+			err = s.serveStream(w, r, a.Origins)
+			break
+		}
+		err = a.serveLocked(w, r, s, strings.Join(parts[2:], "/"))
+	}
+	if err != nil && !w.(*responseWriter).written {
+		status := http.StatusBadRequest
+		var apiErr apiError
+		if errors.As(err, &apiErr) {
+			status = apiErr.status
+		}
+		writeJSON(w, status, map[string]string{"Error": err.Error()})
+	}
+}
+
+func (a *API) serveSessions(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet:
+		a.mu.Lock()
+		sessions := make([]*session, 0, len(a.sessions))
+		for _, s := range a.sessions {
+			sessions = append(sessions, s)
+		}
+		a.mu.Unlock()
+		sort.Slice(sessions, func(i, j int) bool { return sessions[i].id < sessions[j].id })
+		infos := []SessionInfo{}
+		for _, s := range sessions {
+			s.mu.Lock()
+			infos = append(infos, s.info())
+			s.mu.Unlock()
+		}
+		return writeJSON(w, http.StatusOK, infos)
+	case http.MethodPost:
+		s, err := newSession(r)
+		if err != nil {
+			return err
+		}
+		a.mu.Lock()
+		a.nextID++
+		s.id = a.nextID
+		a.sessions[s.id] = s
+		a.mu.Unlock()
+		return writeJSON(w, http.StatusCreated, s.info())
+	}
+	return errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+}
+
+func newSession(r *http.Request) (*session, error) {
+	if err := checkContentType(r, "application/octet-stream"); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "rom"
+	}
+	rom, err := loader.Load(name, data)
+	if err != nil {
+		return nil, err
+	}
+	seed := int64(1)
+	if v := r.URL.Query().Get("seed"); v != "" {
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid seed %q", v)
+		}
+	}
+	s := &session{name: name, rom: rom, io: &chip8.HeadlessIO{}}
+	if s.vm, s.params, err = rom.Boot(s.io); err != nil {
+		return nil, err
+	}
+	s.vm.Seed(seed)
+	return s, nil
+}
+
+// serveLocked serves a request for a session while holding its lock.
+func (a *API) serveLocked(w http.ResponseWriter, r *http.Request, s *session, resource string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return a.serveSession(w, r, s, resource)
+}
+
+func (a *API) serveSession(w http.ResponseWriter, r *http.Request, s *session, resource string) error {
+	switch r.Method + " " + resource {
+	case "GET ":
+		return writeJSON(w, http.StatusOK, s.info())
+	case "DELETE ":
+		a.mu.Lock()
+		delete(a.sessions, s.id)
+		a.mu.Unlock()
+		s.closeStream(nil)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case "POST frames":
+		return s.runFrames(w, r)
+	case "GET memory":
+		return s.readMemory(w, r)
+	case "GET display.png":
+		return s.display(w, r)
+	case "GET state":
+		return writeJSON(w, http.StatusOK, s.vm.SaveState())
+	case "PUT state":
+		if err := checkContentType(r, "application/json"); err != nil {
+			return err
+		}
+		var state chip8.State
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			return fmt.Errorf("invalid save state: %w", err)
+		}
+		if err := s.vm.LoadState(state); err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, s.info())
+	}
+	switch resource {
+	case "", "frames", "memory", "display.png", "state":
+		return errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+	return errorf(http.StatusNotFound, "unknown resource %s", r.URL.Path)
+}
+
+// FramesRequest runs frames of a session with keys held.
+type FramesRequest struct {
+	Frames int
+	Keys   []int
+}
+
+func (s *session) runFrames(w http.ResponseWriter, r *http.Request) error {
+	if err := checkContentType(r, "application/json"); err != nil {
+		return err
+	}
+	var req FramesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	if req.Frames < 0 || req.Frames > maxFrames {
+		return fmt.Errorf("invalid number of frames %d; at most %d can be run at once", req.Frames, maxFrames)
+	}
+	keys := [16]bool{}
+	for _, key := range req.Keys {
+		if key < 0 || key > 0xF {
+			return fmt.Errorf("invalid key %#x", key)
+		}
+		keys[key] = true
+	}
+	s.io.Keys = keys
+	for i := 0; i < req.Frames && !s.vm.Done; i++ {
+		if err := s.runFrame(); err != nil {
+			return errorf(http.StatusUnprocessableEntity, "frame %d: %v", s.frames, err)
+		}
+		s.frames++
+	}
+	return writeJSON(w, http.StatusOK, s.info())
+}
+
+// runFrame runs a frame of the session, which is done once the VM fails,
+// including when it crashes on a program breaking it, e.g. by returning with
+// an empty stack.
+func (s *session) runFrame() (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("VM crashed: %v", v)
+		}
+		if err != nil {
+			s.vm.Done = true
+		}
+	}()
+	return s.vm.RunFrame(s.params)
+}
+
+func (s *session) readMemory(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	addr, length := uint64(0), uint64(len(s.vm.Mem))
+	var err error
+	if v := query.Get("addr"); v != "" {
+		if addr, err = strconv.ParseUint(v, 0, 16); err != nil || addr >= uint64(len(s.vm.Mem)) {
+			return fmt.Errorf("invalid address %q", v)
+		}
+	}
+	if v := query.Get("len"); v != "" {
+		if length, err = strconv.ParseUint(v, 0, 16); err != nil {
+			return fmt.Errorf("invalid length %q", v)
+		}
+	}
+	end := addr + length
+	if end > uint64(len(s.vm.Mem)) {
+		end = uint64(len(s.vm.Mem))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, err = w.Write(s.vm.Mem[addr:end])
+	return err
+}
+
+func (s *session) display(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	opts := render.Options{Palette: render.Classic, Scale: 4}
+	if v := query.Get("palette"); v != "" {
+		palette, ok := render.Palettes[v]
+		if !ok {
+			return fmt.Errorf("unknown palette %q", v)
+		}
+		opts.Palette = palette
+	}
+	if v := query.Get("scale"); v != "" {
+		scale, err := strconv.Atoi(v)
+		if err != nil || scale < 1 || scale > 32 {
+			return fmt.Errorf("invalid scale %q", v)
+		}
+		opts.Scale = scale
+	}
+	w.Header().Set("Content-Type", "image/png")
+	return capture.WritePNG(w, s.vm.Pixels, opts)
+}
+
+// responseWriter tracks whether a response has been written, in which case
+// errors, e.g. the client going away, can no longer be reported.
+type responseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets the connection be hijacked by WebSocket handshakes.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// counts the frames key 5 is held in V5
+var counter = []byte{
+	0x61, 0x05, // LD V1, 5
+	0xE1, 0xA1, // SKNP V1
+	0x75, 0x01, // ADD V5, 1
+	0x12, 0x02, // JP 202
+}
+
+func request(t *testing.T, server *httptest.Server, method, path, body string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bodies are JSON requests or ROMs
+	if json.Valid([]byte(body)) {
+		req.Header.Set("Content-Type", "application/json")
+	} else if body != "" {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if v != nil {
+		if b, ok := v.(*[]byte); ok {
+			*b = data
+		} else if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, data)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	server := httptest.NewServer(NewAPI())
+	defer server.Close()
+
+	var info SessionInfo
+	if status := request(t, server, "POST", "/api/sessions?name=counter.ch8", string(counter), &info); status != http.StatusCreated {
+		t.Fatalf("Create err; status %d", status)
+	}
+	if info.ID != 1 || info.Name != "counter.ch8" || info.Pc != 0x200 {
+		t.Errorf("Create err; %+v", info)
+	}
+
+	request(t, server, "POST", "/api/sessions/1/frames", `{"Frames": 10, "Keys": [5]}`, &info)
+	if info.Frames != 10 || info.Regs[5] == 0 {
+		t.Errorf("Frames err; %+v", info)
+	}
+	var state json.RawMessage
+	request(t, server, "GET", "/api/sessions/1/state", "", &state)
+	v5 := info.Regs[5]
+	request(t, server, "POST", "/api/sessions/1/frames", `{"Frames": 10, "Keys": [5]}`, &info)
+	if status := request(t, server, "PUT", "/api/sessions/1/state", string(state), &info); status != http.StatusOK || info.Regs[5] != v5 {
+		t.Errorf("State err; status %d, V5 %d, want %d", status, info.Regs[5], v5)
+	}
+
+	var mem []byte
+	request(t, server, "GET", "/api/sessions/1/memory?addr=0x200&len=4", "", &mem)
+	if !bytes.Equal(mem, counter[:4]) {
+		t.Errorf("Memory err; %x", mem)
+	}
+	var img []byte
+	request(t, server, "GET", "/api/sessions/1/display.png?scale=2", "", &img)
+	if cfg, err := png.DecodeConfig(bytes.NewReader(img)); err != nil || cfg.Width != 128 {
+		t.Errorf("Display err; %v, %+v", err, cfg)
+	}
+
+	var apiErr struct{ Error string }
+	badStates := []string{}
+	for field, value := range map[string]int{"Sp": 17, "Pc": 0xFFE, "KeyWaitReg": 0x10} {
+		var fields map[string]any
+		json.Unmarshal(state, &fields)
+		fields[field] = value
+		data, _ := json.Marshal(fields)
+		badStates = append(badStates, string(data))
+	}
+	for _, bad := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{"PUT", "/api/sessions/1/state", badStates[0], http.StatusBadRequest},
+		{"PUT", "/api/sessions/1/state", badStates[1], http.StatusBadRequest},
+		{"PUT", "/api/sessions/1/state", badStates[2], http.StatusBadRequest},
+		{"POST", "/api/sessions/1/frames", `{"Frames": 1, "Keys": [16]}`, http.StatusBadRequest},
+		{"PUT", "/api/sessions/1/state", `{"Mem": ""}`, http.StatusBadRequest},
+		{"GET", "/api/sessions/1/display.png?palette=pink", "", http.StatusBadRequest},
+		{"PUT", "/api/sessions/1", "", http.StatusMethodNotAllowed},
+		{"GET", "/api/sessions/1/nothing", "", http.StatusNotFound},
+		{"GET", "/api/sessions/2", "", http.StatusNotFound},
+	} {
+		if status := request(t, server, bad.method, bad.path, bad.body, &apiErr); status != bad.status || apiErr.Error == "" {
+			t.Errorf("%s %s err; status %d, %q", bad.method, bad.path, status, apiErr.Error)
+		}
+	}
+
+	// what the pages of other sites can send without the server agreeing
+	for path, body := range map[string]string{
+		"/api/sessions":          string(counter),
+		"/api/sessions/1/frames": `{"Frames": 1}`,
+	} {
+		resp, err := http.Post(server.URL+path, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("POST %s err; plain text accepted with status %d", path, resp.StatusCode)
+		}
+	}
+
+	if status := request(t, server, "DELETE", "/api/sessions/1", "", nil); status != http.StatusNoContent {
+		t.Errorf("Delete err; status %d", status)
+	}
+	var list []SessionInfo
+	if request(t, server, "GET", "/api/sessions", "", &list); len(list) != 0 {
+		t.Errorf("Delete err; sessions %+v", list)
+	}
+}
+
+func TestCrash(t *testing.T) {
+	server := httptest.NewServer(NewAPI())
+	defer server.Close()
+
+	var info SessionInfo
+	request(t, server, "POST", "/api/sessions?name=crash.ch8", "\x00\xEE", &info) // RET with an empty stack
+	var apiErr struct{ Error string }
+	if status := request(t, server, "POST", "/api/sessions/1/frames", `{"Frames": 1}`, &apiErr); status != http.StatusUnprocessableEntity || apiErr.Error == "" {
+		t.Errorf("Crash err; status %d, %q", status, apiErr.Error)
+	}
+	var list []SessionInfo
+	if request(t, server, "GET", "/api/sessions", "", &list); len(list) != 1 || !list[0].Done {
+		t.Errorf("Crash err; sessions %+v", list)
+	}
+}
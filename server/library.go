@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/loader"
+)
+
+// romExtensions are the extensions of the files indexed besides files without
+// any, as many ROMs are distributed.
+var romExtensions = map[string]bool{
+	".ch8": true, ".c8": true, ".8o": true, ".gif": true, ".hex": true,
+}
+
+// LibraryEntry is what the library knows about a ROM file.
+type LibraryEntry struct {
+	Path     string // the path of the file in the library, with slashes
+	Name     string
+	Size     int64
+	Format   string
+	Hash     string
+	Title    string   `json:",omitempty"`
+	Authors  []string `json:",omitempty"`
+	Platform string   `json:",omitempty"`
+}
+
+func (e LibraryEntry) matches(query string) bool {
+	text := strings.ToLower(strings.Join(append([]string{e.Path, e.Title, e.Platform}, e.Authors...), " "))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Library indexes the ROMs of a directory and its subdirectories, identifying
+// them with the ROM database.
+type Library struct {
+	fsys    fs.FS
+	db      *loader.Database
+	mu      sync.Mutex
+	entries []LibraryEntry
+}
+
+// NewLibrary indexes the ROMs of a directory.
+func NewLibrary(dir string) (*Library, error) {
+	l := &Library{fsys: os.DirFS(dir), db: loader.Default}
+	return l, l.Scan()
+}
+
+// Scan indexes the ROMs anew, e.g. once files have been added; files that are
+// not ROMs the VM can load are left out.
+func (l *Library) Scan() error {
+	entries := []LibraryEntry{}
+	err := fs.WalkDir(l.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != "." && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(path.Ext(p))
+		if strings.HasPrefix(d.Name(), ".") || ext != "" && !romExtensions[ext] {
+			return nil
+		}
+		data, err := fs.ReadFile(l.fsys, p)
+		if err != nil {
+			return err
+		}
+		rom, err := l.db.Load(d.Name(), data)
+		if err != nil {
+			return nil
+		}
+		if _, err := chip8.NewVm(rom.Data, nil); err != nil {
+			return nil
+		}
+		entries = append(entries, LibraryEntry{
+			Path:     p,
+			Name:     d.Name(),
+			Size:     int64(len(data)),
+			Format:   rom.Format.String(),
+			Hash:     rom.Metadata.Hash,
+			Title:    rom.Metadata.Title,
+			Authors:  rom.Metadata.Authors,
+			Platform: rom.Metadata.Platform,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	l.mu.Lock()
+	l.entries = entries
+	l.mu.Unlock()
+	return nil
+}
+
+// Search returns the ROMs whose path, title, authors or platform contain all
+// the words of a query.
+func (l *Library) Search(query string) []LibraryEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	found := []LibraryEntry{}
+	for _, e := range l.entries {
+		if e.matches(query) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// serveLibrary answers the requests for the ROMs of the library:
+//
+//	GET  /api/roms?q=pong  search the ROMs
+//	POST /api/roms         index the ROMs anew
+//	GET  /api/roms/{path}  download a ROM
+func (l *Library) serveLibrary(w http.ResponseWriter, r *http.Request, p string) error {
+	if l == nil {
+		return errorf(http.StatusNotFound, "no ROM directory is served")
+	}
+	switch {
+	case p == "" && r.Method == http.MethodGet:
+		return writeJSON(w, http.StatusOK, l.Search(r.URL.Query().Get("q")))
+	case p == "" && r.Method == http.MethodPost:
+		if err := l.Scan(); err != nil {
+			return errorf(http.StatusInternalServerError, "unable to index the ROMs: %v", err)
+		}
+		return writeJSON(w, http.StatusOK, l.Search(""))
+	case p == "":
+		return errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	case r.Method != http.MethodGet:
+		return errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+	l.mu.Lock()
+	indexed := false
+	for _, e := range l.entries {
+		indexed = indexed || e.Path == p
+	}
+	l.mu.Unlock()
+	if !indexed {
+		return errorf(http.StatusNotFound, "unknown ROM %s", p)
+	}
+	data, err := fs.ReadFile(l.fsys, p)
+	if err != nil {
+		return errorf(http.StatusNotFound, "unable to read ROM %s", p)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bobbynarvy/chip8/loader"
+)
+
+func TestLibrary(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"counter.ch8":      counter,
+		"games/PONG":       {0x12, 0x00},
+		"games/readme.md":  []byte("# Games"),
+		"games/huge.ch8":   make([]byte, 0x1000),
+		".hidden/loop.ch8": {0x12, 0x00},
+		"games/.loop.ch8":  {0x12, 0x00},
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash := loader.Hash(counter)
+	db, err := loader.LoadDatabase(fstest.MapFS{
+		"database/sha1-hashes.json": {Data: []byte(`{"` + hash + `": 0}`)},
+		"database/programs.json": {Data: []byte(`[{
+			"title": "Key Counter",
+			"authors": ["Someone"],
+			"roms": {"` + hash + `": {"platforms": ["superchip"]}}
+		}]`)},
+		"database/platforms.json": {Data: []byte(`[{"id": "superchip", "defaultTickrate": 30, "quirks": {}}]`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	library := &Library{fsys: os.DirFS(dir), db: db}
+	if err := library.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPI()
+	api.Library = library
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	var entries []LibraryEntry
+	request(t, server, "GET", "/api/roms", "", &entries)
+	if len(entries) != 2 || entries[0].Path != "counter.ch8" || entries[1].Path != "games/PONG" {
+		t.Fatalf("Search err; %+v", entries)
+	}
+	if e := entries[0]; e.Name != "counter.ch8" || e.Size != int64(len(counter)) || e.Format != "raw" || e.Hash == "" {
+		t.Errorf("Search err; %+v", e)
+	}
+	if e := entries[0]; e.Title != "Key Counter" || e.Platform != "superchip" || len(e.Authors) != 1 {
+		t.Errorf("Search err; metadata %+v", e)
+	}
+	for _, query := range []string{"key+counter", "someone", "SUPERCHIP"} {
+		request(t, server, "GET", "/api/roms?q="+query, "", &entries)
+		if len(entries) != 1 || entries[0].Path != "counter.ch8" {
+			t.Errorf("Search %s err; %+v", query, entries)
+		}
+	}
+	request(t, server, "GET", "/api/roms?q=GAMES+pong", "", &entries)
+	if len(entries) != 1 || entries[0].Name != "PONG" {
+		t.Errorf("Search err; %+v", entries)
+	}
+
+	var rom []byte
+	if status := request(t, server, "GET", "/api/roms/counter.ch8", "", &rom); status != http.StatusOK || !bytes.Equal(rom, counter) {
+		t.Errorf("Download err; status %d, %x", status, rom)
+	}
+	for _, path := range []string{"/api/roms/games/readme.md", "/api/roms/../counter.ch8", "/api/roms/.hidden/loop.ch8"} {
+		if status := request(t, server, "GET", path, "", nil); status != http.StatusNotFound {
+			t.Errorf("Download %s err; status %d", path, status)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "loop.ch8"), []byte{0x12, 0x00}, 0o644)
+	request(t, server, "POST", "/api/roms", "", &entries)
+	if len(entries) != 3 {
+		t.Errorf("Scan err; %+v", entries)
+	}
+
+	server = httptest.NewServer(NewAPI())
+	defer server.Close()
+	if status := request(t, server, "GET", "/api/roms", "", nil); status != http.StatusNotFound {
+		t.Errorf("No library err; status %d", status)
+	}
+}
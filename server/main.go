@@ -1,17 +1,226 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/loader"
+	"github.com/bobbynarvy/chip8/static"
 )
 
+// Config is the configuration of the server, from its flags or, for those
+// not given, the environment variables CHIP8_ADDR, CHIP8_STATIC, CHIP8_ROMS,
+// CHIP8_API and CHIP8_ORIGINS.
+type Config struct {
+	Addr    string // the address to listen on
+	Static  string // the directory of the frontend, or "" for the embedded one
+	Roms    string // the directory of the ROM library, if any
+	API     bool   // whether to serve the JSON API
+	Origins string // the origins of other sites allowed to open WebSockets, separated by commas
+	Rom     string // the ROM the boot URL opens, if any
+	Open    bool   // whether to open the boot URL in a browser
+}
+
+// defaultStatic is the frontend embedded in the binary if any, or else finds
+// it whether the server runs from the root of the repository or from the
+// server directory.
+func defaultStatic() string {
+	if static.FS != nil {
+		return ""
+	}
+	for _, dir := range []string{"static", "../static"} {
+		if _, err := os.Stat(dir + "/index.html"); err == nil {
+			return dir
+		}
+	}
+	return "static"
+}
+
+func parseConfig(args []string, getenv func(string) string, output io.Writer) (Config, error) {
+	env := func(name, fallback string) string {
+		if v := getenv(name); v != "" {
+			return v
+		}
+		return fallback
+	}
+	api, err := strconv.ParseBool(env("CHIP8_API", "true"))
+	if err != nil {
+		return Config{}, fmt.Errorf("CHIP8_API: %w", err)
+	}
+	cfg := Config{}
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&cfg.Addr, "addr", env("CHIP8_ADDR", ":3000"), "the address to listen on")
+	flags.StringVar(&cfg.Static, "static", env("CHIP8_STATIC", defaultStatic()), "the directory of the frontend")
+	flags.StringVar(&cfg.Roms, "roms", getenv("CHIP8_ROMS"), "serve the ROMs of a directory in the library")
+	flags.BoolVar(&cfg.API, "api", api, "serve the JSON API under /api/")
+	flags.StringVar(&cfg.Origins, "origins", getenv("CHIP8_ORIGINS"), "allow the pages of other `origins`, separated by commas, to open WebSockets")
+	flags.BoolVar(&cfg.Open, "open", false, "open the emulator in a browser")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: server [flags] [rom]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+	if flags.NArg() > 1 {
+		return cfg, errors.New("at most one ROM can be booted")
+	}
+	cfg.Rom = flags.Arg(0)
+	return cfg, nil
+}
+
+// bootURL is the URL of the emulator, booting a ROM file if any.
+func bootURL(base, rom string) (string, error) {
+	if rom == "" {
+		return base, nil
+	}
+	data, err := os.ReadFile(rom)
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 {
+		return "", fmt.Errorf("%s: empty ROM", rom)
+	}
+	name := filepath.Base(rom)
+	loaded, err := loader.Load(name, data)
+	if err == nil {
+		_, err = chip8.NewVm(loaded.Data, nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", rom, err)
+	}
+	return base + loader.Fragment(name, data), nil
+}
+
+// openBrowser opens a URL in the default browser of the system.
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
+
+// newHandler serves the frontend and, if enabled, the API, which it returns
+// so that it can be closed on shutdown.
+func newHandler(cfg Config) (http.Handler, *API, error) {
+	frontend := static.FS
+	if cfg.Static != "" {
+		if info, err := os.Stat(cfg.Static); err != nil || !info.IsDir() {
+			return nil, nil, fmt.Errorf("no frontend directory %s", cfg.Static)
+		}
+		frontend = os.DirFS(cfg.Static)
+	} else if frontend == nil {
+		return nil, nil, errors.New("no frontend is embedded; build with the embed tag")
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", newStaticHandler(frontend))
+	if !cfg.API {
+		if cfg.Roms != "" {
+			return nil, nil, errors.New("the ROM library is served by the API")
+		}
+		return mux, nil, nil
+	}
+	api := NewAPI()
+	for _, origin := range strings.Split(cfg.Origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			api.Origins = append(api.Origins, origin)
+		}
+	}
+	if cfg.Roms != "" {
+		library, err := NewLibrary(cfg.Roms)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("Serving %d ROMs from %s", len(library.Search("")), cfg.Roms)
+		api.Library = library
+	}
+	mux.Handle("/api/", api)
+	return mux, api, nil
+}
+
+// serve serves HTTP until the context is done, then shuts down gracefully,
+// letting the requests being answered finish for a few seconds.
+func serve(ctx context.Context, server *http.Server, ln net.Listener) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(ln)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
 func main() {
-	fs := http.FileServer(http.Dir("../static"))
-	http.Handle("/", fs)
+	cfg, err := parseConfig(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	handler, api, err := newHandler(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{Addr: cfg.Addr, Handler: handler}
+	if api != nil {
+		server.RegisterOnShutdown(api.Close)
+	}
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	log.Println("Listening on http://localhost:3000/index.html")
-	err := http.ListenAndServe(":3000", nil)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	url, err := bootURL(fmt.Sprintf("http://%s/index.html", net.JoinHostPort(host, port)), cfg.Rom)
 	if err != nil {
 		log.Fatal(err)
 	}
+	log.Printf("Listening on %s", url)
+	if cfg.Open {
+		if err := openBrowser(url); err != nil {
+			log.Printf("Unable to open a browser: %v", err)
+		}
+	}
+	if err := serve(ctx, server, ln); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Shut down")
 }
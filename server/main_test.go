@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bobbynarvy/chip8/loader"
+	"github.com/bobbynarvy/chip8/static"
+)
+
+func TestParseConfig(t *testing.T) {
+	env := map[string]string{"CHIP8_ADDR": ":8080", "CHIP8_ROMS": "roms", "CHIP8_API": "false"}
+	cfg, err := parseConfig([]string{"-static", "www"}, func(name string) string { return env[name] }, io.Discard)
+	if err != nil || cfg != (Config{Addr: ":8080", Static: "www", Roms: "roms", API: false}) {
+		t.Errorf("Config err; %v, %+v", err, cfg)
+	}
+	cfg, err = parseConfig([]string{"-addr", "localhost:0", "-api", "-origins", "https://a.example"}, func(name string) string { return env[name] }, io.Discard)
+	if err != nil || cfg.Addr != "localhost:0" || !cfg.API || cfg.Origins != "https://a.example" {
+		t.Errorf("Flags err; %v, %+v", err, cfg)
+	}
+	cfg, err = parseConfig([]string{"-open", "pong.ch8"}, func(name string) string { return env[name] }, io.Discard)
+	if err != nil || cfg.Rom != "pong.ch8" || !cfg.Open {
+		t.Errorf("ROM err; %v, %+v", err, cfg)
+	}
+	if _, err := parseConfig([]string{"a.ch8", "b.ch8"}, func(name string) string { return env[name] }, io.Discard); err == nil {
+		t.Error("ROM err; two ROMs accepted")
+	}
+	env["CHIP8_API"] = "maybe"
+	if _, err := parseConfig(nil, func(name string) string { return env[name] }, io.Discard); err == nil {
+		t.Error("Config err; invalid CHIP8_API accepted")
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func get(t *testing.T, server *httptest.Server, path, acceptEncoding string) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", server.URL+path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	// the transport would otherwise decompress gzip responses itself
+	resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+func TestStatic(t *testing.T) {
+	wasm := []byte("\x00asm\x01\x00\x00\x00")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(wasm)
+	zw.Close()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{
+		"index.html":   []byte("<html></html>"),
+		"main.wasm":    wasm,
+		"main.wasm.gz": gz.Bytes(),
+		"main.wasm.br": []byte("brotli"),
+	})
+	handler, api, err := newHandler(Config{Static: dir})
+	if err != nil || api != nil {
+		t.Fatalf("Handler err; %v, %v", err, api)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, test := range []struct {
+		acceptEncoding, encoding string
+		body                     []byte
+	}{
+		{"", "", wasm},
+		{"gzip, deflate", "gzip", gz.Bytes()},
+		{"gzip, deflate, br", "br", []byte("brotli")},
+		{"br;q=0, gzip;q=0.5", "gzip", gz.Bytes()},
+		{"*;q=0", "", wasm},
+	} {
+		resp, body := get(t, server, "/main.wasm", test.acceptEncoding)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/wasm" ||
+			resp.Header.Get("Content-Encoding") != test.encoding || resp.Header.Get("Vary") != "Accept-Encoding" ||
+			!bytes.Equal(body, test.body) {
+			t.Errorf("Accept-Encoding %q err; status %d, headers %v, body %q", test.acceptEncoding, resp.StatusCode, resp.Header, body)
+		}
+	}
+	resp, body := get(t, server, "/", "gzip")
+	if resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Vary") != "" || string(body) != "<html></html>" {
+		t.Errorf("Uncompressed err; headers %v, body %q", resp.Header, body)
+	}
+	if resp, _ := get(t, server, "/api/sessions", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("API disabled err; status %d", resp.StatusCode)
+	}
+
+	if _, _, err := newHandler(Config{Static: filepath.Join(dir, "missing"), API: true}); err == nil {
+		t.Error("Handler err; missing frontend accepted")
+	}
+	handler, api, err = newHandler(Config{Static: dir, API: true, Origins: "https://a.example, https://b.example"})
+	if err != nil || api == nil {
+		t.Fatalf("Handler err; %v, %v", err, api)
+	}
+	if len(api.Origins) != 2 || api.Origins[1] != "https://b.example" {
+		t.Errorf("Handler err; origins: %q", api.Origins)
+	}
+	server = httptest.NewServer(handler)
+	defer server.Close()
+	if resp, _ := get(t, server, "/api/sessions", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("API err; status %d", resp.StatusCode)
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	embedded := static.FS
+	defer func() { static.FS = embedded }()
+	static.FS = nil
+	if _, _, err := newHandler(Config{}); err == nil {
+		t.Error("Handler err; missing embedded frontend accepted")
+	}
+	static.FS = fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}
+	if defaultStatic() != "" {
+		t.Errorf("Default err; %q", defaultStatic())
+	}
+	handler, _, err := newHandler(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	if resp, body := get(t, server, "/", ""); resp.StatusCode != http.StatusOK || string(body) != "<html></html>" {
+		t.Errorf("Embedded err; status %d, body %q", resp.StatusCode, body)
+	}
+}
+
+func TestBootURL(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{"counter.ch8": counter, "huge.ch8": make([]byte, 0x1000), "empty.ch8": nil})
+	base := "http://localhost:3000/index.html"
+	url, err := bootURL(base, filepath.Join(dir, "counter.ch8"))
+	if err != nil || !strings.HasPrefix(url, base+"#") {
+		t.Fatalf("Boot URL err; %v, %s", err, url)
+	}
+	if name, data, err := loader.ParseFragment(strings.TrimPrefix(url, base)); err != nil || name != "counter.ch8" || !bytes.Equal(data, counter) {
+		t.Errorf("Boot URL err; %v, %s, % x", err, name, data)
+	}
+	if url, err := bootURL(base, ""); err != nil || url != base {
+		t.Errorf("Boot URL err; %v, %s", err, url)
+	}
+	for _, rom := range []string{"missing.ch8", "huge.ch8", "empty.ch8"} {
+		if _, err := bootURL(base, filepath.Join(dir, rom)); err == nil {
+			t.Errorf("Boot URL err; %s accepted", rom)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPI()
+	server := &http.Server{Handler: api}
+	server.RegisterOnShutdown(api.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, server, ln) }()
+
+	resp, err := http.Post("http://"+ln.Addr().String()+"/api/sessions", "application/octet-stream", bytes.NewReader(counter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	conn, err := dialWebSocket(ln.Addr().String(), "/api/sessions/1/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Shutdown err; %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown err; still serving")
+	}
+	conn.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			t.Fatal("Shutdown err; stream still open")
+		}
+		if err != nil {
+			break
+		}
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/api/sessions"); err == nil {
+		t.Error("Shutdown err; still accepting connections")
+	}
+}
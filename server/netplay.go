@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/bobbynarvy/chip8/netplay"
+)
+
+// netplayRooms relays the messages of netplay games between their two
+// players; a room is named by the players and exists while they are in it.
+type netplayRooms struct {
+	mu    sync.Mutex
+	rooms map[string]*[2]*netplayPlayer
+}
+
+// netplayPlayer is a player in a room; the messages they are sent are queued
+// so that a slow connection only holds up its own player.
+type netplayPlayer struct {
+	conn  *wsConn
+	queue chan []byte
+}
+
+// send queues a message for a player, disconnecting them if they cannot keep
+// up, as any message lost would desync the game.
+func (p *netplayPlayer) send(data []byte) {
+	select {
+	case p.queue <- data:
+	default:
+		p.conn.conn.Close()
+	}
+}
+
+func (p *netplayPlayer) sendMessage(msg netplay.Message) {
+	data, _ := json.Marshal(msg)
+	p.send(data)
+}
+
+// relayed reports whether a message of a player is to be relayed to the
+// other player: messages about the room are only sent by the server.
+func relayed(op byte, data []byte) bool {
+	var msg netplay.Message
+	if op != opText || json.Unmarshal(data, &msg) != nil {
+		return false
+	}
+	switch msg.Type {
+	case netplay.Joined, netplay.Peer, netplay.Left:
+		return false
+	}
+	return true
+}
+
+// serveRoom joins a player to a room over WebSocket, telling them whether
+// they are the first or second player and when the other player joins or
+// leaves; any other message is relayed as is to the other player.
+func (n *netplayRooms) serveRoom(w http.ResponseWriter, r *http.Request, name string, origins []string) error {
+	n.mu.Lock()
+	if n.rooms == nil {
+		n.rooms = map[string]*[2]*netplayPlayer{}
+	}
+	room := n.rooms[name]
+	if room == nil {
+		room = &[2]*netplayPlayer{}
+	}
+	player := 0
+	if room[0] != nil {
+		player = 1
+	}
+	if room[player] != nil {
+		n.mu.Unlock()
+		return errorf(http.StatusConflict, "room %s is full", name)
+	}
+	conn, err := upgrade(w, r, origins)
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	p := &netplayPlayer{conn: conn, queue: make(chan []byte, 64)}
+	go func() {
+		for data := range p.queue {
+			if err := conn.WriteMessage(opText, data); err != nil {
+				break
+			}
+		}
+		conn.Close()
+	}()
+	n.rooms[name] = room
+	room[player] = p
+	p.sendMessage(netplay.Message{Type: netplay.Joined, Player: player})
+	if other := room[1-player]; other != nil {
+		p.sendMessage(netplay.Message{Type: netplay.Peer})
+		other.sendMessage(netplay.Message{Type: netplay.Peer})
+	}
+	n.mu.Unlock()
+
+	for {
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if !relayed(op, data) {
+			continue
+		}
+		n.mu.Lock()
+		if other := room[1-player]; other != nil {
+			other.send(data)
+		}
+		n.mu.Unlock()
+	}
+
+	n.mu.Lock()
+	room[player] = nil
+	close(p.queue)
+	if other := room[1-player]; other != nil {
+		other.sendMessage(netplay.Message{Type: netplay.Left})
+	} else {
+		delete(n.rooms, name)
+	}
+	n.mu.Unlock()
+	return nil
+}
+
+// close disconnects the players of all the rooms.
+func (n *netplayRooms) close() {
+	n.mu.Lock()
+	conns := []*wsConn{}
+	for _, room := range n.rooms {
+		for _, p := range room {
+			if p != nil {
+				conns = append(conns, p.conn)
+			}
+		}
+	}
+	n.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bobbynarvy/chip8/netplay"
+)
+
+func TestNetplayRoom(t *testing.T) {
+	server := httptest.NewServer(NewAPI())
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+	read := func(conn *wsConn) netplay.Message {
+		t.Helper()
+		var msg netplay.Message
+		if _, data, err := conn.ReadMessage(); err != nil || json.Unmarshal(data, &msg) != nil {
+			t.Fatalf("Netplay err; %v: %s", err, data)
+		}
+		return msg
+	}
+
+	first, err := dialWebSocket(addr, "/api/netplay/pong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := read(first); msg.Type != netplay.Joined || msg.Player != 0 {
+		t.Errorf("Netplay err; %+v", msg)
+	}
+	second, err := dialWebSocket(addr, "/api/netplay/pong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := read(second); msg.Type != netplay.Joined || msg.Player != 1 {
+		t.Errorf("Netplay err; %+v", msg)
+	}
+	if read(first).Type != netplay.Peer || read(second).Type != netplay.Peer {
+		t.Error("Netplay err; players not told of each other")
+	}
+	if status := request(t, server, "GET", "/api/netplay/pong", "", nil); status != http.StatusConflict {
+		t.Errorf("Netplay err; status %d joining a full room", status)
+	}
+
+	second.WriteMessage(opText, []byte(`{"Type": "left"}`)) // only sent by the server
+	second.WriteMessage(opText, []byte(`{"Type": "input", "Frame": 3, "Keys": 2}`))
+	if msg := read(first); msg != (netplay.Message{Type: netplay.Input, Frame: 3, Keys: 2}) {
+		t.Errorf("Netplay err; relayed %+v", msg)
+	}
+	second.Close()
+	if msg := read(first); msg.Type != netplay.Left {
+		t.Errorf("Netplay err; %+v", msg)
+	}
+	first.Close()
+}
+
+// TestNetplaySlowPlayer checks that a player not reading their messages does
+// not hold up the other rooms.
+func TestNetplaySlowPlayer(t *testing.T) {
+	server := httptest.NewServer(NewAPI())
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+	join := func(room string) *wsConn {
+		t.Helper()
+		conn, err := dialWebSocket(addr, "/api/netplay/"+room)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	fast, slow := join("slow"), join("slow")
+	defer fast.Close()
+	defer slow.Close()
+	msg := []byte(`{"Type": "hash", "Hash": "` + strings.Repeat("0", 60000) + `"}`)
+	go func() {
+		for i := 0; i < 500; i++ {
+			if fast.WriteMessage(opText, msg) != nil {
+				return
+			}
+		}
+	}()
+
+	relayed := make(chan error, 1)
+	go func() {
+		first, second := join("other"), join("other")
+		defer first.Close()
+		defer second.Close()
+		second.WriteMessage(opText, []byte(`{"Type": "input", "Frame": 1}`))
+		for {
+			_, data, err := first.ReadMessage()
+			if err != nil || strings.Contains(string(data), "input") {
+				relayed <- err
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-relayed:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Netplay err; rooms held up by a slow player")
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	api := NewAPI()
+	api.Origins = []string{"https://friend.example"}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	for origin, status := range map[string]int{
+		"":                       http.StatusSwitchingProtocols,
+		server.URL:               http.StatusSwitchingProtocols,
+		"https://friend.example": http.StatusSwitchingProtocols,
+		"https://evil.example":   http.StatusForbidden,
+	} {
+		req, _ := http.NewRequest("GET", server.URL+"/api/netplay/origin", nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Origin err; %q: status %d", origin, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	// browsers only compile WebAssembly streamed with its own type, which the
+	// MIME types of the system may lack
+	mime.AddExtensionType(".wasm", "application/wasm")
+}
+
+// precompressed are the encodings of the compressed copies static files may
+// have, in order of preference, with the extensions of the copies.
+var precompressed = []struct{ encoding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// acceptsEncoding reports whether the client accepts an encoding in its
+// Accept-Encoding header.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, accepted := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(accepted, ";")
+			name = strings.TrimSpace(name)
+			if name != encoding && name != "*" {
+				continue
+			}
+			q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+			if weight, err := strconv.ParseFloat(q, 64); ok && err == nil && weight == 0 {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// staticHandler serves the files of the frontend; a file with a copy
+// compressed ahead of time, like main.wasm.br or main.wasm.gz for main.wasm,
+// is served compressed to the clients that accept it.
+type staticHandler struct {
+	fsys  fs.FS
+	files http.Handler
+}
+
+func newStaticHandler(fsys fs.FS) *staticHandler {
+	return &staticHandler{fsys: fsys, files: http.FileServer(http.FS(fsys))}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		vary := false
+		for _, p := range precompressed {
+			if _, err := fs.Stat(h.fsys, name+p.ext); err != nil {
+				continue
+			}
+			if !vary {
+				w.Header().Add("Vary", "Accept-Encoding")
+				vary = true
+			}
+			if acceptsEncoding(r, p.encoding) && h.serveCompressed(w, r, name, p.encoding, p.ext) {
+				return
+			}
+		}
+	}
+	h.files.ServeHTTP(w, r)
+}
+
+// serveCompressed serves the compressed copy of a file as the file itself,
+// reporting whether it could.
+func (h *staticHandler) serveCompressed(w http.ResponseWriter, r *http.Request, name, encoding, ext string) bool {
+	f, err := h.fsys.Open(name + ext)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	content, ok := f.(io.ReadSeeker)
+	if err != nil || !ok || info.IsDir() {
+		return false
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Encoding", encoding)
+	http.ServeContent(w, r, name, info.ModTime(), content)
+	return true
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/stream"
+)
+
+// streamClient is a client watching a session over WebSocket; the keys of
+// spectators are ignored.
+type streamClient struct {
+	send      chan []byte // the display messages to send
+	keys      [16]bool
+	spectator bool
+	err       error // the failure of the session the client is disconnected for, if any
+}
+
+// sessionStream runs a session in real time while clients watch it, holding
+// the keys any of its players holds.
+type sessionStream struct {
+	clients map[*streamClient]bool
+	sent    chip8.Pixels // the display as last sent
+	stop    chan struct{}
+}
+
+// serveStream streams a session to a WebSocket client until it disconnects;
+// the session runs in real time as long as a client watches it. Clients are
+// sent the changes of the display and send the keys they press, as encoded by
+// the stream package; the keys of clients connecting with `?spectate` are
+// ignored.
+func (s *session) serveStream(w http.ResponseWriter, r *http.Request, origins []string) error {
+	conn, err := upgrade(w, r, origins)
+	if err != nil {
+		return err
+	}
+	c := &streamClient{send: make(chan []byte, 16), spectator: r.URL.Query().Has("spectate")}
+	s.mu.Lock()
+	s.join(c)
+	s.mu.Unlock()
+
+	go func() {
+		for msg := range c.send {
+			if err := conn.WriteMessage(opBinary, msg); err != nil {
+				conn.Close()
+				return
+			}
+		}
+		if c.err != nil {
+			conn.closeWithError(c.err.Error())
+		} else {
+			conn.Close()
+		}
+	}()
+	for {
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var event stream.KeyEvent
+		if op != opText || c.spectator || json.Unmarshal(data, &event) != nil || !event.Valid() {
+			continue
+		}
+		s.mu.Lock()
+		c.keys[event.Key] = event.Pressed
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	s.leave(c)
+	s.mu.Unlock()
+	return nil
+}
+
+// join adds a client to the stream of the session, starting to run the
+// session in real time for the first one; the client is sent the whole
+// display.
+func (s *session) join(c *streamClient) {
+	if s.stream.clients == nil {
+		s.stream.clients = map[*streamClient]bool{}
+	}
+	if len(s.stream.clients) == 0 {
+		s.stream.stop = make(chan struct{})
+		go s.runStream(s.stream.stop)
+	}
+	s.broadcast() // so that the clients are sent the same display
+	s.stream.clients[c] = true
+	var sent chip8.Pixels
+	c.send <- stream.EncodeDisplay(&sent, s.vm.Pixels, true)
+}
+
+// leave removes a client from the stream, stopping the session once nobody
+// watches it anymore.
+func (s *session) leave(c *streamClient) {
+	if !s.stream.clients[c] {
+		return
+	}
+	delete(s.stream.clients, c)
+	close(c.send)
+	if len(s.stream.clients) == 0 {
+		close(s.stream.stop)
+	}
+}
+
+// closeStream disconnects all the clients, e.g. when the session is deleted,
+// telling them the failure of the session that ends the stream if any.
+func (s *session) closeStream(err error) {
+	for c := range s.stream.clients {
+		c.err = err
+		s.leave(c)
+	}
+}
+
+func (s *session) runStream(stop chan struct{}) {
+	defer func() {
+		if v := recover(); v != nil {
+			err := fmt.Errorf("stream crashed: %v", v)
+			log.Printf("session %d: %v", s.id, err)
+			s.mu.Lock()
+			s.vm.Done = true
+			s.closeStream(err)
+			s.mu.Unlock()
+		}
+	}()
+	ticker := time.NewTicker(time.Second / 60)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		s.tick(stop)
+	}
+}
+
+func (s *session) tick(stop chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-stop: // the last client left while waiting for the lock
+	default:
+		s.streamFrame()
+	}
+}
+
+// streamFrame runs a frame with the keys held by the players; the clients are
+// disconnected once the session fails.
+func (s *session) streamFrame() {
+	keys := [16]bool{}
+	for c := range s.stream.clients {
+		for key, pressed := range c.keys {
+			keys[key] = keys[key] || (pressed && !c.spectator)
+		}
+	}
+	s.io.Keys = keys
+	if !s.vm.Done {
+		if err := s.runFrame(); err != nil {
+			err = fmt.Errorf("frame %d: %w", s.frames, err)
+			log.Printf("session %d: %v", s.id, err)
+			s.broadcast()
+			s.closeStream(err)
+			return
+		}
+		s.frames++
+	}
+	s.broadcast()
+}
+
+// broadcast sends the rows of the display that changed since they were last
+// sent; clients too slow to keep up are disconnected.
+func (s *session) broadcast() {
+	msg := stream.EncodeDisplay(&s.stream.sent, s.vm.Pixels, false)
+	if msg == nil {
+		return
+	}
+	for c := range s.stream.clients {
+		select {
+		case c.send <- msg:
+		default:
+			s.leave(c)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/stream"
+)
+
+func TestStream(t *testing.T) {
+	server := httptest.NewServer(NewAPI())
+	defer server.Close()
+	request(t, server, "POST", "/api/sessions", string(counter), nil)
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	player, err := dialWebSocket(addr, "/api/sessions/1/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	spectator, err := dialWebSocket(addr, "/api/sessions/1/stream?spectate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spectator.Close()
+
+	var display chip8.Pixels
+	op, msg, err := spectator.ReadMessage()
+	if err != nil || op != opBinary || len(msg) != 32*9 || stream.DecodeDisplay(msg, &display) != nil {
+		t.Fatalf("Stream err; first message %d bytes, %v", len(msg), err)
+	}
+
+	// only the keys of players are held
+	var info SessionInfo
+	spectator.WriteMessage(opText, []byte(`{"Key": 5, "Pressed": true}`))
+	time.Sleep(100 * time.Millisecond)
+	if request(t, server, "GET", "/api/sessions/1", "", &info); info.Frames == 0 || info.Regs[5] != 0 {
+		t.Errorf("Stream err; spectator key held: %+v", info)
+	}
+	player.WriteMessage(opText, []byte(`{"Key": 5, "Pressed": true}`))
+	deadline := time.Now().Add(2 * time.Second)
+	for info.Regs[5] == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		request(t, server, "GET", "/api/sessions/1", "", &info)
+	}
+	if info.Regs[5] == 0 {
+		t.Errorf("Stream err; player key not held: %+v", info)
+	}
+
+	request(t, server, "DELETE", "/api/sessions/1", "", nil)
+	for {
+		if _, _, err := player.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if status := request(t, server, "GET", "/api/sessions/1/stream", "", nil); status != http.StatusNotFound {
+		t.Errorf("Stream err; status %d for a deleted session", status)
+	}
+}
+
+func TestStreamCrash(t *testing.T) {
+	server := httptest.NewServer(NewAPI())
+	defer server.Close()
+	request(t, server, "POST", "/api/sessions?name=crash.ch8", "\x00\xEE", nil) // RET with an empty stack
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	player, err := dialWebSocket(addr, "/api/sessions/1/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	player.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err = player.ReadMessage(); err != nil {
+			break
+		}
+	}
+	var closed closeError
+	if !errors.As(err, &closed) || closed.code != closeInternalError || !strings.Contains(closed.reason, "crashed") {
+		t.Errorf("Crash err; %v", err)
+	}
+	var info SessionInfo
+	if status := request(t, server, "GET", "/api/sessions/1", "", &info); status != http.StatusOK || !info.Done {
+		t.Errorf("Crash err; status %d, %+v", status, info)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// The subset of the WebSocket protocol (RFC 6455) the server needs: single
+// frame or fragmented messages, ping, pong and close, without extensions.
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// maxMessageSize bounds the messages read, which are small key events.
+const maxMessageSize = 1 << 16
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// closeInternalError is the status of a close frame sent because of a failure
+// of the server.
+const closeInternalError = 1011
+
+// closeError is returned by ReadMessage once the peer closed the connection,
+// with the status and reason it gave, if any.
+type closeError struct {
+	code   int
+	reason string
+}
+
+func (e closeError) Error() string {
+	if e.reason == "" {
+		return "websocket closed"
+	}
+	return "websocket closed: " + e.reason
+}
+
+type wsConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	client bool // the client end masks the frames it writes
+	mu     sync.Mutex
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowedOrigin reports whether the page a WebSocket is opened from may use
+// it: any page of the server itself or of the origins allowed, "*" allowing
+// all. Clients other than browsers send no origin.
+func allowedOrigin(r *http.Request, origins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// upgrade answers the opening handshake of a WebSocket client and takes over
+// the connection. Browsers are refused the connection from the pages of
+// other sites, which could otherwise use the server of the machine they run
+// on, unless their origin is allowed.
+func upgrade(w http.ResponseWriter, r *http.Request, origins []string) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		return nil, errorf(http.StatusBadRequest, "expected a WebSocket handshake")
+	}
+	if !allowedOrigin(r, origins) {
+		return nil, errorf(http.StatusForbidden, "origin %s not allowed", r.Header.Get("Origin"))
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, errorf(http.StatusUpgradeRequired, "unsupported WebSocket version")
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, errorf(http.StatusInternalServerError, "the connection cannot be upgraded: %v", err)
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// dialWebSocket opens a WebSocket client connection; it is used by tests.
+func dialWebSocket(addr, path string) (*wsConn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", path, addr, key)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("handshake refused: %s", resp.Status)
+	}
+	return &wsConn{conn: conn, r: r, client: true}, nil
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if c.client {
+		header[1] |= 0x80
+		mask := make([]byte, 4)
+		rand.Read(mask)
+		header = append(header, mask...)
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ mask[i%4]
+		}
+		payload = masked
+	}
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WriteMessage sends a text or binary message.
+func (c *wsConn) WriteMessage(op byte, payload []byte) error {
+	return c.writeFrame(op, payload)
+}
+
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.r, header[:]); err != nil {
+		return
+	}
+	fin, op = header[0]&0x80 != 0, header[0]&0xF
+	masked := header[1]&0x80 != 0
+	if masked == c.client {
+		return fin, op, nil, errors.New("websocket: wrong masking")
+	}
+	n := uint64(header[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxMessageSize {
+		return fin, op, nil, errors.New("websocket: message too large")
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings and
+// closes on the way; it returns a closeError once the peer closed the
+// connection.
+func (c *wsConn) ReadMessage() (op byte, payload []byte, err error) {
+	var message []byte
+	for {
+		fin, frameOp, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch frameOp {
+		case opPing:
+			c.writeFrame(opPong, data)
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeFrame(opClose, data)
+			closed := closeError{}
+			if len(data) >= 2 {
+				closed.code, closed.reason = int(binary.BigEndian.Uint16(data)), string(data[2:])
+			}
+			return 0, nil, closed
+		case opText, opBinary:
+			op = frameOp
+			message = data
+		case opContinuation:
+			if len(message)+len(data) > maxMessageSize {
+				return 0, nil, errors.New("websocket: message too large")
+			}
+			message = append(message, data...)
+		default:
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %#x", frameOp)
+		}
+		if fin {
+			return op, message, nil
+		}
+	}
+}
+
+// Close sends a close frame and closes the connection.
+func (c *wsConn) Close() error {
+	c.writeFrame(opClose, nil)
+	return c.conn.Close()
+}
+
+// closeWithError closes the connection because of a failure of the server,
+// telling the peer why.
+func (c *wsConn) closeWithError(reason string) error {
+	if len(reason) > 123 { // the payload of a control frame is 125 bytes at most
+		reason = reason[:123]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, closeInternalError)
+	c.writeFrame(opClose, append(payload, reason...))
+	return c.conn.Close()
+}
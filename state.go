@@ -0,0 +1,147 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+)
+
+// State is a save state: a snapshot of everything a program can observe,
+// from which a VM resumes as if it had never been interrupted. It does not
+// hold the IO, the hooks, the coverage, or the quirks and halt policy, which
+// are settings rather than state. It can be stored as JSON.
+type State struct {
+	Mem           []byte
+	Stack         [16]uint16
+	Regs          [16]byte
+	I             uint16
+	DT, ST        byte
+	Pc            uint16
+	Sp            byte
+	Keys          [16]bool
+	Pixels        Pixels
+	Done          bool
+	Buzzing       bool
+	LastSprite    Sprite
+	Halted        HaltReason
+	WaitingForKey bool
+	KeyWaitReg    byte
+	KeysDown      [16]bool
+	KeysRead      bool
+	LastState     uint64
+	StillFrames   int
+	Rand          *uint64 `json:",omitempty"` // the state of the random numbers of a VM seeded with Seed
+}
+
+// SaveState takes a snapshot of the VM.
+func (vm *Vm) SaveState() State {
+	s := State{
+		Mem:           append([]byte{}, vm.Mem...),
+		Stack:         vm.Stack,
+		Regs:          vm.Regs,
+		I:             vm.I,
+		DT:            vm.DT,
+		ST:            vm.ST,
+		Pc:            vm.Pc,
+		Sp:            vm.Sp,
+		Keys:          vm.Keys,
+		Pixels:        vm.Pixels,
+		Done:          vm.Done,
+		Buzzing:       vm.Buzzing,
+		LastSprite:    vm.LastSprite,
+		Halted:        vm.Halted,
+		WaitingForKey: vm.WaitingForKey,
+		KeyWaitReg:    vm.KeyWaitReg,
+		KeysDown:      vm.keysDown,
+		KeysRead:      vm.keysRead,
+		LastState:     vm.lastState,
+		StillFrames:   vm.stillFrames,
+	}
+	if vm.randSource != nil {
+		r := vm.randSource.state
+		s.Rand = &r
+	}
+	return s
+}
+
+// LoadState restores a snapshot taken by SaveState; the whole display is
+// presented again at the end of the next frame. A snapshot with PC or SP out
+// of the ranges SetRegister allows, or waiting on an unknown register, is
+// rejected; I can be any address, as programs can move it past the memory.
+func (vm *Vm) LoadState(s State) error {
+	switch {
+	case len(s.Mem) != len(vm.Mem):
+		return errors.New("invalid save state: wrong memory size")
+	case int(s.Pc) > len(vm.Mem)-2:
+		return fmt.Errorf("invalid save state: PC %#x is out of range", s.Pc)
+	case int(s.Sp) > len(vm.Stack):
+		return fmt.Errorf("invalid save state: SP %#x is out of range", s.Sp)
+	case s.KeyWaitReg > 0xF:
+		return fmt.Errorf("invalid save state: unknown register V%X", s.KeyWaitReg)
+	}
+	copy(vm.Mem, s.Mem)
+	vm.Stack, vm.Regs, vm.I = s.Stack, s.Regs, s.I
+	vm.DT, vm.ST, vm.Pc, vm.Sp = s.DT, s.ST, s.Pc, s.Sp
+	vm.Keys, vm.Pixels, vm.Done = s.Keys, s.Pixels, s.Done
+	vm.Buzzing, vm.LastSprite, vm.Halted = s.Buzzing, s.LastSprite, s.Halted
+	vm.WaitingForKey, vm.KeyWaitReg, vm.keysDown = s.WaitingForKey, s.KeyWaitReg, s.KeysDown
+	vm.keysRead, vm.lastState, vm.stillFrames = s.KeysRead, s.LastState, s.StillFrames
+	if s.Rand != nil {
+		vm.Seed(0)
+		vm.randSource.state = *s.Rand
+	}
+	vm.dirty = FullScreen
+	return nil
+}
+
+// Hash fingerprints a save state, e.g. to check that two VMs meant to run in
+// lockstep have not diverged.
+func (s *State) Hash() uint64 {
+	h := fnv.New64a()
+	h.Write(s.Mem)
+	for _, row := range s.Pixels {
+		h.Write(row[:])
+	}
+	binary.Write(h, binary.LittleEndian, s.Stack)
+	h.Write(s.Regs[:])
+	for _, v := range []any{
+		s.I, s.DT, s.ST, s.Pc, s.Sp, s.Keys, s.Done, s.Buzzing, s.LastSprite.Addr, int64(s.LastSprite.Height),
+		int64(s.Halted), s.WaitingForKey, s.KeyWaitReg, s.KeysDown, s.KeysRead, s.LastState, int64(s.StillFrames),
+	} {
+		binary.Write(h, binary.LittleEndian, v)
+	}
+	if s.Rand != nil {
+		binary.Write(h, binary.LittleEndian, *s.Rand)
+	}
+	return h.Sum64()
+}
+
+// Seed makes the random numbers of Cxkk reproducible, and part of the save
+// states of the VM unlike those of a source set directly in Rand.
+func (vm *Vm) Seed(seed int64) {
+	vm.randSource = &randSource{state: uint64(seed)}
+	vm.Rand = rand.New(vm.randSource)
+}
+
+// randSource is a SplitMix64 generator, whose state is a single number.
+type randSource struct {
+	state uint64
+}
+
+func (s *randSource) Uint64() uint64 {
+	s.state += 0x9E3779B97F4A7C15
+	z := s.state
+	z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+	z = (z ^ z>>27) * 0x94D049BB133111EB
+	return z ^ z>>31
+}
+
+func (s *randSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (s *randSource) Seed(seed int64) {
+	s.state = uint64(seed)
+}
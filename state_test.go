@@ -0,0 +1,75 @@
+package chip8
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSaveState(t *testing.T) {
+	// draws random digits while waiting for keys
+	rom := []byte{
+		0xC1, 0x0F, // RND V1, F
+		0xF1, 0x29, // LD F, V1
+		0xD2, 0x25, // DRW V2, V2, 5
+		0x72, 0x01, // ADD V2, 1
+		0xF3, 0x0A, // LD V3, K
+		0x12, 0x00, // JP 200
+	}
+	io := &HeadlessIO{}
+	vm, _ := NewVm(rom, io)
+	vm.Seed(3)
+	run := func(frames int) []byte {
+		for i := 0; i < frames; i++ {
+			io.Keys[5] = i%4 < 2
+			vm.RunFrame(RunParams{InstCount: 10})
+		}
+		return append([]byte{vm.Regs[1], vm.Regs[2], vm.Regs[3]}, vm.Mem[:0x50]...)
+	}
+	run(7)
+
+	data, err := json.Marshal(vm.SaveState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixels := vm.Pixels
+	want := run(20)
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.LoadState(state); err != nil {
+		t.Fatal(err)
+	}
+	if vm.Pixels != pixels {
+		t.Error("Save state err; display not restored")
+	}
+	if got := run(20); string(got) != string(want) {
+		t.Errorf("Save state err; resumed run differs: %x, want %x", got, want)
+	}
+	resumed := vm.SaveState()
+	vm.LoadState(state)
+	run(20)
+	if again := vm.SaveState(); again.Hash() != resumed.Hash() || state.Hash() == resumed.Hash() {
+		t.Error("Save state err; hashes do not match the states")
+	}
+
+	// after 16 nested calls, and with I moved past the memory by Fx1E
+	full := state
+	full.Sp, full.I = 16, 0xFFFF
+	if err := vm.LoadState(full); err != nil {
+		t.Errorf("Save state err; full stack rejected: %v", err)
+	}
+	for name, corrupt := range map[string]func(s *State){
+		"truncated memory": func(s *State) { s.Mem = s.Mem[:10] },
+		"PC out of memory": func(s *State) { s.Pc = 0xFFE },
+		"SP out of stack":  func(s *State) { s.Sp = 17 },
+		"unknown register": func(s *State) { s.KeyWaitReg = 0x10 },
+	} {
+		bad := state
+		corrupt(&bad)
+		if err := vm.LoadState(bad); err == nil {
+			t.Errorf("Save state err; %s accepted", name)
+		}
+	}
+}
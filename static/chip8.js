@@ -2,67 +2,573 @@ const elem = document.getElementById.bind(document);
 const go = new Go();
 const onWasmLoad = (result) => {
 	go.run(result.instance);
+	Chip8.onRenderReady();
 	const romInput = elem("rom");
 
+	let romName = "rom";
 	romInput.addEventListener("change", () => {
 		const file = romInput.files[0];
+		romName = file.name;
 		const reader = new FileReader();
 
 		reader.addEventListener("load", (event) => {
 			const buffer = event.target.result;
 			const byteArray = new Uint8Array(buffer);
 
-			createNewVm(...byteArray);
+			createNewVm(file.name, byteArray);
 		});
 		reader.readAsArrayBuffer(file);
 	});
 
+	elem("paste-load").addEventListener("click", () => {
+		const bytes = new TextEncoder().encode(elem("paste").value);
+		romName = "pasted";
+		createNewVm(romName, bytes);
+	});
+
+	elem("screenshot").addEventListener("click", () => {
+		const png = screenshot();
+		if (png) {
+			download(`${romName}.png`, png, "image/png");
+		}
+	});
+	const recordButton = elem("record");
+	recordButton.addEventListener("click", () => {
+		const gif = toggleRecording();
+		recordButton.textContent = gif ? "Record GIF" : "Stop recording";
+		if (gif) {
+			download(`${romName}.gif`, gif, "image/gif");
+		}
+	});
+
+	// a link like `#rom=<base64>&name=pong.ch8` boots the ROM it contains
+	const bootFromLocation = () => {
+		if (!location.hash.includes("rom=")) {
+			return;
+		}
+		const error = bootFromFragment(location.hash);
+		if (error) {
+			Chip8.onRomError(error);
+		} else {
+			romName = new URLSearchParams(location.hash.slice(1)).get("name") || "rom";
+		}
+	};
+	window.addEventListener("hashchange", bootFromLocation);
+	bootFromLocation();
+
 	// DOM element interactions
 	elem("debug").addEventListener("change", toggleDebug);
 	elem("next-inst").addEventListener("click", nextInst);
+	[
+		["coverage-html", "html", "text/html"],
+		["coverage-lcov", "lcov", "text/plain"],
+	].forEach(([id, format, type]) => {
+		elem(id).addEventListener("click", () => {
+			const report = coverageReport(format, romName);
+			if (report) {
+				download(`${romName}.${format === "lcov" ? "info" : "html"}`, report, type);
+			}
+		});
+	});
+};
+
+const download = (fileName, data, type) => {
+	const link = document.createElement("a");
+	link.href = URL.createObjectURL(new Blob([data], { type }));
+	link.download = fileName;
+	link.click();
+	URL.revokeObjectURL(link.href);
 };
 
 window.Chip8 = (() => {
 	const display = elem("chip8-display");
 	const ctx = display.getContext("2d");
 	const assembly = [];
-	let pixels = [];
-	const keyByteMap = {
-		1: 0x1,
-		2: 0x2,
-		3: 0x3,
-		q: 0x4,
-		w: 0x5,
-		e: 0x6,
-		a: 0x7,
-		s: 0x8,
-		d: 0x9,
-		z: 0xa,
-		x: 0x0,
-		c: 0xb,
-		4: 0xc,
-		r: 0xd,
-		f: 0xe,
-		v: 0xf,
-	};
-
 	const runStateChangeHandler = (state) => {
 		elem("debug").disabled = !state.romLoaded;
 		elem("next-inst").disabled = !(state.romLoaded && state.inDebug);
+		elem("coverage-html").disabled = !state.romLoaded;
+		elem("coverage-lcov").disabled = !state.romLoaded;
 		elem("debug-container").style.display = state.inDebug ? "block" : "none";
+		elem("debug-key-waiting").style.display = state.waitingForKey ? "block" : "none";
 	};
 
-	// Tell the VM which keys are being pressed
+	// Keys and gamepad inputs are mapped to the keypad by the VM; the keymap of
+	// each ROM can be changed and is saved by the hash of the ROM
+	let romHash = null;
+	let binding = null; // the key the next input will be bound to
+	const keymapLayout = [0x1, 0x2, 0x3, 0xc, 0x4, 0x5, 0x6, 0xd, 0x7, 0x8, 0x9, 0xe, 0xa, 0x0, 0xb, 0xf];
+	const showKeymap = () => {
+		const inputs = keymapInputs();
+		const cells = elem("keymap").getElementsByTagName("button");
+		keymapLayout.forEach((key, i) => {
+			const label = key === binding ? "press a key..." : inputs[key].join(" ");
+			cells.item(i).textContent = `${key.toString(16).toUpperCase()}: ${label}`;
+		});
+	};
+	keymapLayout.forEach((key, i) => {
+		if (i % 4 === 0) {
+			elem("keymap").appendChild(document.createElement("tr"));
+		}
+		const td = document.createElement("td");
+		const button = document.createElement("button");
+		button.addEventListener("click", () => {
+			binding = key;
+			showKeymap();
+		});
+		td.appendChild(button);
+		elem("keymap").lastChild.appendChild(td);
+	});
+	elem("keymap-reset").addEventListener("click", () => {
+		resetKeymap();
+		if (romHash) {
+			localStorage.removeItem(`keymap:${romHash}`);
+		}
+		binding = null;
+		showKeymap();
+	});
+
+	// Tell the VM which inputs are being pressed, or bind the input to a key
+	const onInput = (input, pressed) => {
+		if (binding !== null) {
+			if (pressed) {
+				const saved = bindInput(input, binding);
+				if (romHash) {
+					localStorage.setItem(`keymap:${romHash}`, saved);
+				}
+				binding = null;
+				showKeymap();
+			}
+			return true;
+		}
+		return pressInput(input, pressed);
+	};
 	["keydown", "keyup"].forEach((keyEvent) => {
 		document.body.addEventListener(keyEvent, (event) => {
-			const byte = keyByteMap[event.key];
-			// explicit test for 0; it will be ignored otherwise
-			if (byte || byte === 0) {
-				setKey(byte, keyEvent === "keydown");
+			if (["INPUT", "TEXTAREA", "SELECT"].includes(event.target.tagName)) {
+				return;
+			}
+			if (onInput(event.code, keyEvent === "keydown")) {
+				event.preventDefault();
 			}
 		});
 	});
 
+	// the Gamepad API has no events for inputs; poll the state of the gamepads
+	// on each animation frame and report the inputs that have changed
+	const gamepadInputs = {};
+	const pollGamepads = () => {
+		const inputs = {};
+		navigator.getGamepads().forEach((pad) => {
+			if (!pad) {
+				return;
+			}
+			pad.buttons.forEach((button, i) => {
+				inputs[`Button${i}`] ||= button.pressed;
+			});
+			pad.axes.forEach((value, i) => {
+				inputs[`Axis${i}-`] ||= value < -0.5;
+				inputs[`Axis${i}+`] ||= value > 0.5;
+			});
+		});
+		Object.entries(inputs).forEach(([input, pressed]) => {
+			if ((gamepadInputs[input] || false) !== pressed) {
+				gamepadInputs[input] = pressed;
+				onInput(input, pressed);
+			}
+		});
+		window.requestAnimationFrame(pollGamepads);
+	};
+	window.addEventListener(
+		"gamepadconnected",
+		() => window.requestAnimationFrame(pollGamepads),
+		{ once: true },
+	);
+
+	// The touch keypad; each pointer presses the key it went down on so that
+	// several keys can be held with several fingers
+	const touchKeypad = elem("touch-keypad");
+	let touchKeys = null; // the keys the ROM uses, or null if they are unknown
+	const pointers = new Map(); // the key held by each pointer
+	const releasePointer = (event) => {
+		const key = pointers.get(event.pointerId);
+		if (key === undefined) {
+			return;
+		}
+		pointers.delete(event.pointerId);
+		if (![...pointers.values()].includes(key)) {
+			setKey(key, false);
+			touchKeypad.children.item(keymapLayout.indexOf(key)).classList.remove("pressed");
+		}
+	};
+	keymapLayout.forEach((key) => {
+		const button = document.createElement("button");
+		button.textContent = key.toString(16).toUpperCase();
+		button.addEventListener("pointerdown", (event) => {
+			event.preventDefault();
+			button.releasePointerCapture(event.pointerId);
+			pointers.set(event.pointerId, key);
+			button.classList.add("pressed");
+			setKey(key, true);
+		});
+		["pointerup", "pointercancel", "pointerleave"].forEach((pointerEvent) => {
+			button.addEventListener(pointerEvent, releasePointer);
+		});
+		touchKeypad.appendChild(button);
+	});
+	const showTouchKeypad = () => {
+		const all = elem("touch-all-keys").checked || !touchKeys;
+		keymapLayout.forEach((key, i) => {
+			const hidden = !all && !touchKeys.includes(key);
+			touchKeypad.children.item(i).style.visibility = hidden ? "hidden" : "visible";
+		});
+		touchKeypad.style.display = elem("touch").checked ? "grid" : "none";
+	};
+	elem("touch").checked = window.matchMedia("(pointer: coarse)").matches;
+	["touch", "touch-all-keys"].forEach((id) => {
+		elem(id).addEventListener("change", showTouchKeypad);
+	});
+	showTouchKeypad();
+
+	// Memory viewer; bytes and registers can be edited in place while paused
+	let memoryPageNum = 2; // the page of the program start
+	let vmState = null;
+	const hex = (value, digits) => value.toString(16).toUpperCase().padStart(digits, "0");
+	const showMemory = () => {
+		const view = memoryPage(memoryPageNum);
+		if (!view) {
+			return;
+		}
+		elem("memory-page").textContent = `${memoryPageNum + 1}/${view.pages}`;
+		const tbody = elem("memory");
+		tbody.replaceChildren();
+		view.rows.forEach((row) => {
+			const tr = document.createElement("tr");
+			const addr = document.createElement("td");
+			addr.className = "memory-addr";
+			addr.textContent = hex(row.addr, 3);
+			tr.appendChild(addr);
+			row.bytes.forEach((value, i) => {
+				const td = document.createElement("td");
+				td.textContent = hex(value, 2);
+				td.classList.add("editable");
+				td.dataset.addr = row.addr + i;
+				[[1, "mark-i"], [2, "mark-pc"], [4, "mark-sprite"]].forEach(([mark, className]) => {
+					if (row.marks[i] & mark) {
+						td.classList.add(className);
+					}
+				});
+				tr.appendChild(td);
+			});
+			const ascii = document.createElement("td");
+			ascii.className = "memory-ascii";
+			ascii.textContent = row.ascii;
+			tr.appendChild(ascii);
+			tbody.appendChild(tr);
+		});
+	};
+	const goToPage = (page) => {
+		const view = memoryPage(page);
+		if (view && page >= 0 && page < view.pages) {
+			memoryPageNum = page;
+			showMemory();
+		}
+	};
+	elem("memory-prev").addEventListener("click", () => goToPage(memoryPageNum - 1));
+	elem("memory-next").addEventListener("click", () => goToPage(memoryPageNum + 1));
+	elem("memory-pc").addEventListener("click", () => vmState && goToPage(vmState.Pc >> 8));
+	elem("memory-i").addEventListener("click", () => vmState && goToPage(vmState.I >> 8));
+
+	// the disassembly of an instruction is kept until it is executed again;
+	// edited bytes may belong to the instruction before them
+	const invalidateAssembly = (addr) => {
+		const lis = elem("debug-instructions-list").getElementsByTagName("li");
+		[addr - 1, addr].forEach((instAddr) => {
+			if (assembly[instAddr] !== undefined) {
+				assembly[instAddr] = disassemble(instAddr);
+				lis.item(instAddr).textContent = assembly[instAddr];
+			}
+		});
+	};
+
+	// an editable element becomes editable on click and its hex value is
+	// applied on Enter or when it loses focus
+	const edit = (target) => {
+		const original = target.textContent;
+		target.contentEditable = "true";
+		target.focus();
+		document.getSelection().selectAllChildren(target);
+		const commit = (apply) => {
+			target.contentEditable = "false";
+			target.removeEventListener("blur", onBlur);
+			target.removeEventListener("keydown", onKey);
+			const value = parseInt(target.textContent.trim(), 16);
+			let error = null;
+			if (apply && target.textContent.trim() !== original) {
+				if (Number.isNaN(value)) {
+					error = `invalid value: ${target.textContent}`;
+				} else if (target.dataset.addr !== undefined) {
+					error = pokeMemory(Number(target.dataset.addr), value);
+					if (!error) {
+						invalidateAssembly(Number(target.dataset.addr));
+					}
+				} else {
+					error = setRegister(target.dataset.reg, value);
+				}
+			}
+			if (error || !apply) {
+				target.textContent = original;
+			}
+			if (error) {
+				console.log(error);
+			}
+			showMemory();
+		};
+		const onBlur = () => commit(true);
+		const onKey = (event) => {
+			event.stopPropagation();
+			if (event.key === "Enter" || event.key === "Escape") {
+				event.preventDefault();
+				commit(event.key === "Enter");
+			}
+		};
+		target.addEventListener("blur", onBlur);
+		target.addEventListener("keydown", onKey);
+	};
+	elem("debug-container").addEventListener("click", (event) => {
+		const target = event.target;
+		if (target.classList.contains("editable") && target.contentEditable !== "true") {
+			edit(target);
+		}
+	});
+
+	// Sprite viewer; memory is decoded as sprites laid out in a sheet
+	const spriteArgs = () => [
+		parseInt(elem("sprite-addr").value, 16) || 0,
+		Number(elem("sprite-height").value),
+		Number(elem("sprite-count").value),
+		elem("sprite-wide").checked,
+	];
+	const showSprites = () => {
+		const sheet = spriteSheet(...spriteArgs());
+		const canvas = elem("sprite-sheet");
+		if (!sheet) {
+			canvas.width = canvas.height = 0;
+			return;
+		}
+		canvas.width = sheet.width;
+		canvas.height = sheet.height;
+		const image = new ImageData(new Uint8ClampedArray(sheet.data.buffer), sheet.width, sheet.height);
+		canvas.getContext("2d").putImageData(image, 0, 0);
+	};
+	["sprite-addr", "sprite-height", "sprite-count", "sprite-wide"].forEach((id) => {
+		elem(id).addEventListener("change", showSprites);
+	});
+	elem("sprite-last").addEventListener("click", () => {
+		const sprite = vmState && vmState.LastSprite;
+		if (sprite && sprite.height) {
+			elem("sprite-addr").value = hex(sprite.addr, 3);
+			elem("sprite-height").value = sprite.height;
+			elem("sprite-wide").checked = false;
+			showSprites();
+		}
+	});
+	elem("sprite-png").addEventListener("click", () => {
+		const png = spriteSheetPNG(...spriteArgs());
+		if (png) {
+			download(`sprites-${elem("sprite-addr").value}.png`, png, "image/png");
+		}
+	});
+
+	// Cheats; the codes of each ROM are saved by the hash of the ROM
+	const showCheats = () => {
+		const codes = cheatCodes();
+		if (romHash) {
+			localStorage.setItem(`cheats:${romHash}`, codes.saved);
+		}
+		const list = elem("cheat-list");
+		list.replaceChildren();
+		codes.list.forEach((code, i) => {
+			const li = document.createElement("li");
+			const enabled = document.createElement("input");
+			enabled.type = "checkbox";
+			enabled.checked = code.enabled;
+			enabled.addEventListener("change", () => {
+				enableCheat(i, enabled.checked);
+				showCheats();
+			});
+			const remove = document.createElement("button");
+			remove.textContent = "Remove";
+			remove.addEventListener("click", () => {
+				removeCheat(i);
+				showCheats();
+			});
+			li.append(enabled, ` ${code.code} ${code.name} `, remove);
+			list.appendChild(li);
+		});
+	};
+	elem("cheat-add").addEventListener("click", () => {
+		const error = addCheat(elem("cheat-code").value, elem("cheat-name").value);
+		elem("cheat-error").textContent = error || "";
+		if (!error) {
+			elem("cheat-code").value = elem("cheat-name").value = "";
+			showCheats();
+		}
+	});
+	document.querySelectorAll("[data-search]").forEach((button) => {
+		button.addEventListener("click", () => {
+			const found = cheatSearch(button.dataset.search, parseInt(elem("search-value").value, 16) || 0);
+			if (!found) {
+				return;
+			}
+			elem("search-count").textContent = `${found.count} found`;
+			const list = elem("search-results");
+			list.replaceChildren();
+			found.results.forEach(([addr, value]) => {
+				const li = document.createElement("li");
+				li.textContent = `${hex(addr, 3)}: ${hex(value, 2)}`;
+				li.addEventListener("click", () => {
+					elem("cheat-code").value = `${hex(addr, 3)}=${hex(value, 2)}`;
+				});
+				list.appendChild(li);
+			});
+		});
+	});
+
+	// Achievements; those unlocked for each ROM are saved by the hash of the ROM
+	const showAchievements = () => {
+		const achievements = achievementList();
+		if (romHash) {
+			localStorage.setItem(`achievements:${romHash}`, achievements.saved);
+		}
+		const unlocked = achievements.list.filter((a) => a.unlocked).length;
+		elem("achievements-count").textContent = `${unlocked}/${achievements.list.length}`;
+		const list = elem("achievement-list");
+		list.replaceChildren();
+		achievements.list.forEach((a) => {
+			const li = document.createElement("li");
+			li.classList.toggle("unlocked", a.unlocked);
+			const title = document.createElement("strong");
+			title.textContent = a.title;
+			li.append(title, a.description ? ` ${a.description}` : "");
+			list.appendChild(li);
+		});
+	};
+	let toastTimeout = null;
+	const toast = (message) => {
+		const elemToast = elem("toast");
+		elemToast.textContent = message;
+		elemToast.classList.add("shown");
+		clearTimeout(toastTimeout);
+		toastTimeout = setTimeout(() => elemToast.classList.remove("shown"), 4000);
+	};
+
+	// `?stream=<session>` shows a session of the server API run by the server
+	// instead of running ROMs here; `&spectate` only watches it
+	let sendStreamKey = () => {};
+	const connectStream = () => {
+		const params = new URLSearchParams(location.search);
+		const session = params.get("stream");
+		if (!session) {
+			return;
+		}
+		const spectate = params.has("spectate");
+		const scheme = location.protocol === "https:" ? "wss" : "ws";
+		const ws = new WebSocket(
+			`${scheme}://${location.host}/api/sessions/${session}/stream${spectate ? "?spectate" : ""}`,
+		);
+		ws.binaryType = "arraybuffer";
+		elem("rom").disabled = elem("paste-load").disabled = true;
+		setStreaming(true);
+		ws.addEventListener("open", () => {
+			elem("rom-info").textContent = `${spectate ? "Watching" : "Playing"} session ${session} run by the server`;
+		});
+		ws.addEventListener("message", (event) => streamFrame(new Uint8Array(event.data)));
+		ws.addEventListener("close", (event) => {
+			elem("rom-info").textContent = `The stream of session ${session} is closed${event.reason ? `: ${event.reason}` : ""}`;
+		});
+		sendStreamKey = (key, pressed) => {
+			if (!spectate && ws.readyState === WebSocket.OPEN) {
+				ws.send(JSON.stringify({ Key: key, Pressed: pressed }));
+			}
+		};
+	};
+
+	// Netplay; the server relays the messages of the two players of a room
+	let netplaySocket = null;
+	elem("netplay-join").addEventListener("click", () => {
+		if (netplaySocket) {
+			netplaySocket.close();
+			return;
+		}
+		const room = elem("netplay-room").value.trim();
+		if (!room) {
+			return;
+		}
+		setNetplayDelay(Number(elem("netplay-delay").value));
+		const scheme = location.protocol === "https:" ? "wss" : "ws";
+		const ws = new WebSocket(`${scheme}://${location.host}/api/netplay/${encodeURIComponent(room)}`);
+		netplaySocket = ws;
+		elem("netplay-join").textContent = "Leave";
+		ws.addEventListener("message", (event) => netplayMessage(event.data));
+		ws.addEventListener("close", () => {
+			netplaySocket = null;
+			leaveNetplay();
+			elem("netplay-join").textContent = "Join";
+		});
+	});
+
+	// ROM library; the server lists the ROMs of its ROM directory, which boot
+	// with the settings the ROM database recommends for them
+	let librarySearch = null;
+	const showLibrary = () => {
+		const query = elem("library-search").value.trim();
+		const search = fetch(`/api/roms?q=${encodeURIComponent(query)}`).then((response) =>
+			response.json().then((body) => (response.ok ? body : Promise.reject(body.Error))),
+		);
+		librarySearch = search;
+		search
+			.then((entries) => {
+				if (search !== librarySearch) {
+					return;
+				}
+				elem("library-count").textContent = `${entries.length} ROMs`;
+				const list = elem("library-list");
+				list.replaceChildren();
+				entries.forEach((entry) => {
+					const li = document.createElement("li");
+					const details = document.createElement("span");
+					details.className = "details";
+					details.textContent = [entry.Authors && entry.Authors.join(", "), entry.Platform, entry.Path]
+						.filter(Boolean)
+						.join(" · ");
+					li.append(`${entry.Title || entry.Name} `, details);
+					li.addEventListener("click", () => {
+						fetch(`/api/roms/${entry.Path.split("/").map(encodeURIComponent).join("/")}`)
+							.then((response) => response.arrayBuffer())
+							.then((data) => {
+								romName = entry.Name;
+								createNewVm(romName, new Uint8Array(data));
+							});
+					});
+					list.appendChild(li);
+				});
+			})
+			.catch((error) => {
+				if (search === librarySearch) {
+					elem("library-count").textContent = `The library is unavailable: ${error}`;
+				}
+			});
+	};
+	elem("library-container").addEventListener("toggle", () => {
+		if (elem("library-container").open) {
+			showLibrary();
+		}
+	});
+	elem("library-search").addEventListener("input", showLibrary);
+
+	elem("halt-policy").addEventListener("change", (event) => setHaltPolicy(event.target.value));
+
 	const help = elem("help");
 	const helpToggle = elem("help-toggle");
 	helpToggle.onclick = () => {
@@ -73,98 +579,117 @@ window.Chip8 = (() => {
 		}
 	};
 
-	// contains arrays of pixels that have been erased; first one is oldest
-	let previousPixels = [];
-	(() => {
-		const alphaDelta = 0.2;
-		const framesToShowErased = 3;
-		// delete erased pixels that have already been shown for a
-		// certain number of frames
-		const deletePreviousPixels = () => {
-			if (previousPixels[0]?.framesShown >= framesToShowErased) {
-				previousPixels.shift();
-				deletePreviousPixels();
+	// the display is rendered by the VM into `displayImage`; only the area that
+	// has changed since the last animation frame is painted onto the canvas
+	let displayImage = null;
+	const paintDisplay = () => {
+		const changed = renderDisplay();
+		if (displayImage && changed) {
+			const [x, y, w, h] = changed;
+			ctx.putImageData(displayImage, 0, 0, x, y, w, h);
+		}
+		window.requestAnimationFrame(paintDisplay);
+	};
+
+	const renderOptionsChangeHandler = () => {
+		setRenderOptions(
+			elem("palette").value,
+			elem("scanlines").checked ? 0.4 : 0,
+			Number(elem("ghosting").value),
+		);
+	};
+	["palette", "scanlines", "ghosting"].forEach((id) => {
+		elem(id).addEventListener("change", renderOptionsChangeHandler);
+	});
+
+	return {
+		setDisplayImage: (image) => {
+			displayImage = image;
+			window.requestAnimationFrame(paintDisplay);
+		},
+		onRenderReady: () => {
+			renderOptionsChangeHandler();
+			setHaltPolicy(elem("halt-policy").value);
+			showKeymap();
+			connectStream();
+			fetch("achievements.json")
+				.then((response) => (response.ok ? response.text() : null))
+				.then((definitions) => {
+					const error = definitions && setAchievements(definitions);
+					if (error) {
+						console.log(`Unable to load achievements: ${error}`);
+					}
+				});
+		},
+		onRomLoaded: (meta, keys) => {
+			elem("halt-info").textContent = "";
+			touchKeys = keys;
+			showTouchKeypad();
+			romHash = meta.hash;
+			const saved = localStorage.getItem(`keymap:${romHash}`);
+			if (saved && setKeymap(saved)) {
+				localStorage.removeItem(`keymap:${romHash}`);
 			}
-		};
-		const draw = (alpha) => ([x, y]) => {
-			ctx.globalAlpha = alpha;
-			ctx.beginPath();
-			ctx.rect(x * 10, y * 10, 10, 10); // scale each CHIP-8 pixel by 10 pixels
-			ctx.fillStyle = "black";
-			ctx.fill();
-			ctx.lineWidth = 1;
-			ctx.strokeStyle = "white";
-			ctx.stroke();
-		};
-		const drawPixels = () => {
-			ctx.clearRect(0, 0, display.width, display.height);
-			deletePreviousPixels();
-			// draw the erased pixels for a certain number of frames in order to reduce
-			// flickering; for each frame the erased pixel fades out a little
-			previousPixels.forEach((pixelSet) => {
-				pixelSet.pixels.forEach(draw(pixelSet.alpha));
-				pixelSet.framesShown++;
-				pixelSet.alpha -= alphaDelta;
-			});
-			// draw the newest set of pixels
-			pixels.forEach(draw(1));
-			window.requestAnimationFrame(drawPixels);
-		};
-		window.requestAnimationFrame(drawPixels);
-	})();
+			binding = null;
+			showKeymap();
 
-	const findErasedPixels = (curPixels, newPixels) => {
-		const pixelMap = newPixels.reduce((acc, [x, y]) => {
-			if (!acc[x]) {
-				acc[x] = {};
+			const savedCheats = localStorage.getItem(`cheats:${romHash}`);
+			if (savedCheats && setCheats(savedCheats)) {
+				localStorage.removeItem(`cheats:${romHash}`);
 			}
-			acc[x][y] = 1;
-			return acc;
-		}, {});
+			elem("search-count").textContent = "";
+			elem("search-results").replaceChildren();
+			showCheats();
 
-		return curPixels.reduce((acc, pixels) => {
-			const [x, y] = pixels;
-			if (!pixelMap[x]?.[y]) {
-				acc.push(pixels);
+			const savedAchievements = localStorage.getItem(`achievements:${romHash}`);
+			if (savedAchievements && restoreAchievements(savedAchievements)) {
+				localStorage.removeItem(`achievements:${romHash}`);
 			}
-			return acc;
-		}, []);
-	};
+			showAchievements();
 
-	return {
-		clearDisplay: () => {
-			pixels = [];
-			ctx.clearRect(0, 0, display.width, display.height);
+			const info = [meta.title || "Unknown ROM"];
+			if (meta.authors.length) {
+				info.push(`by ${meta.authors.join(", ")}`);
+			}
+			if (meta.platform) {
+				info.push(`(${meta.platform})`);
+			}
+			elem("rom-info").textContent = info.join(" ");
 		},
-		draw: (vmPixels) => {
-			previousPixels.push({
-				pixels: findErasedPixels(pixels, vmPixels),
-				framesShown: 0,
-				alpha: 0.95,
-			});
-			pixels = vmPixels;
+		onHalt: (reason, stopped) => {
+			elem("halt-info").textContent =
+				reason === "running" ? "" : `Program over (${reason})${stopped ? "" : "; still running"}`;
 		},
-		waitForKeyPress: () => {
-			const keyWaitingDiv = elem("debug-key-waiting");
-			keyWaitingDiv.style.display = "block";
-			return {
-				onRelease: (keyReleased) => {
-					console.log(`Key released: ${keyReleased}`);
-					keyWaitingDiv.style.display = "none";
-				},
-			};
+		onAchievement: (title, description) => {
+			toast(`Achievement unlocked: ${title}${description ? ` (${description})` : ""}`);
+			showAchievements();
+		},
+		onStreamKey: (key, pressed) => sendStreamKey(key, pressed),
+		onNetplaySend: (msg) => {
+			if (netplaySocket && netplaySocket.readyState === WebSocket.OPEN) {
+				netplaySocket.send(msg);
+			}
+		},
+		onNetplayStatus: (status) => {
+			elem("netplay-status").textContent = status;
+		},
+		onRomError: (message) => {
+			elem("rom-info").textContent = `Unable to load ROM: ${message}`;
 		},
 		onRunStateInit: runStateChangeHandler,
 		onRunStateUpdate: runStateChangeHandler,
 		onVmUpdate: (state) => {
 			// show the register data
-			["Pc", "Sp", "I", "DT"].forEach((reg) => {
+			vmState = state;
+			["Pc", "Sp", "I", "DT", "ST"].forEach((reg) => {
 				elem(reg).textContent = state[reg].toString(16);
 			});
 			const regTrs = elem("registers").children;
 			state.Regs.forEach((reg, i) => {
 				const td = regTrs.item(i % 8).children.item(i < 8 ? 1 : 3);
 				td.textContent = reg.toString(16);
+				td.classList.add("editable");
+				td.dataset.reg = `V${i.toString(16)}`;
 			});
 
 			// show the stack
@@ -199,6 +724,14 @@ window.Chip8 = (() => {
 			newActive.textContent = state.Assembly;
 			newActive.classList.add("active-inst");
 			newActive.scrollIntoView({ block: "center" });
+			showMemory();
+
+			// show the last sprite drawn
+			const sprite = state.LastSprite;
+			elem("last-sprite").textContent = sprite.height
+				? `I=${hex(sprite.addr, 3)}, height ${sprite.height}`
+				: "none";
+			showSprites();
 		},
 	};
 })();
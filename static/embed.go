@@ -0,0 +1,12 @@
+//go:build embed
+
+package static
+
+import "embed"
+
+//go:embed index.html style.css chip8.js wasm_exec.js achievements.json main.wasm*
+var files embed.FS
+
+func init() {
+	FS = files
+}
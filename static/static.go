@@ -0,0 +1,11 @@
+// Package static holds the frontend of the emulator: the page, its scripts
+// and styles, and main.wasm once built by `make build`.
+//
+// Built with the `embed` tag, it embeds them into the binaries using it, like
+// the server built by `make dist`, which then serves the emulator on its own.
+package static
+
+import "io/fs"
+
+// FS holds the embedded frontend, or is nil without the `embed` tag.
+var FS fs.FS
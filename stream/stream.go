@@ -0,0 +1,68 @@
+// Package stream encodes the messages exchanged with the thin clients
+// watching a VM run by the server: the changes of the display sent to the
+// clients and the key events sent back.
+//
+// A display message is a binary WebSocket message made of the rows of the
+// display that changed since the previous message, each as its index followed
+// by 8 bytes holding its 64 pixels, most significant bit first. Key events
+// are text messages holding a KeyEvent as JSON.
+package stream
+
+import (
+	"errors"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+const rowSize = 1 + 64/8
+
+// KeyEvent is the press or release of a key by a client.
+type KeyEvent struct {
+	Key     int
+	Pressed bool
+}
+
+func (e KeyEvent) Valid() bool {
+	return e.Key >= 0 && e.Key <= 0xF
+}
+
+// EncodeDisplay encodes the rows of a display that differ from those sent
+// last, all of them if full, and records them as sent. It returns nil when
+// no row has changed.
+func EncodeDisplay(sent *chip8.Pixels, pixels chip8.Pixels, full bool) []byte {
+	var msg []byte
+	for y, row := range pixels {
+		if !full && row == sent[y] {
+			continue
+		}
+		msg = append(msg, byte(y))
+		for x := 0; x < len(row); x += 8 {
+			var b byte
+			for i, p := range row[x : x+8] {
+				if p != 0 {
+					b |= 0x80 >> i
+				}
+			}
+			msg = append(msg, b)
+		}
+	}
+	*sent = pixels
+	return msg
+}
+
+// DecodeDisplay applies the rows of a display message to a display.
+func DecodeDisplay(msg []byte, pixels *chip8.Pixels) error {
+	if len(msg)%rowSize != 0 {
+		return errors.New("invalid display message")
+	}
+	for ; len(msg) > 0; msg = msg[rowSize:] {
+		y := int(msg[0])
+		if y >= len(pixels) {
+			return errors.New("invalid display message")
+		}
+		for x := range pixels[y] {
+			pixels[y][x] = msg[1+x/8] >> (7 - x%8) & 1
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/bobbynarvy/chip8"
+)
+
+func TestDisplay(t *testing.T) {
+	var sent, shown, pixels chip8.Pixels
+	pixels[3][0], pixels[3][63], pixels[31][9] = 1, 1, 1
+
+	msg := EncodeDisplay(&sent, pixels, false)
+	if len(msg) != 2*rowSize || msg[0] != 3 || msg[1] != 0x80 || msg[8] != 0x01 {
+		t.Errorf("Encode err; %x", msg)
+	}
+	if err := DecodeDisplay(msg, &shown); err != nil || shown != pixels {
+		t.Errorf("Decode err; %v", err)
+	}
+	if msg := EncodeDisplay(&sent, pixels, false); msg != nil {
+		t.Errorf("Encode err; unchanged rows sent: %x", msg)
+	}
+	if msg := EncodeDisplay(&sent, pixels, true); len(msg) != 32*rowSize {
+		t.Errorf("Encode err; %d bytes for the full display", len(msg))
+	}
+
+	for _, bad := range [][]byte{{3, 0}, {32, 0, 0, 0, 0, 0, 0, 0, 0}} {
+		if err := DecodeDisplay(bad, &shown); err == nil {
+			t.Errorf("Decode err; %x accepted", bad)
+		}
+	}
+}
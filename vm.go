@@ -1,38 +1,107 @@
-package main
+package chip8
 
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"time"
 )
 
 type Pixels [32][64]byte
 
+// Region is a rectangular area of the display, in pixels.
+type Region struct {
+	X, Y, W, H int
+}
+
+func (r Region) Empty() bool {
+	return r.W <= 0 || r.H <= 0
+}
+
+// Union returns the smallest region containing both r and s.
+func (r Region) Union(s Region) Region {
+	if r.Empty() {
+		return s
+	}
+	if s.Empty() {
+		return r
+	}
+	u := r
+	if s.X < u.X {
+		u.X = s.X
+	}
+	if s.Y < u.Y {
+		u.Y = s.Y
+	}
+	if s.X+s.W > r.X+r.W {
+		u.W = s.X + s.W - u.X
+	} else {
+		u.W = r.X + r.W - u.X
+	}
+	if s.Y+s.H > r.Y+r.H {
+		u.H = s.Y + s.H - u.Y
+	} else {
+		u.H = r.Y + r.H - u.Y
+	}
+	return u
+}
+
+// Sprite is the location of a sprite in memory; each byte is a row of 8 pixels.
+type Sprite struct {
+	Addr   uint16
+	Height int
+}
+
+// FullScreen is the region covering the whole display.
+var FullScreen = Region{W: 64, H: 32}
+
 type IO interface {
-	ClearScreen()
-	Draw(bytes Pixels)
-	WaitKeyPress() (byte, bool) // the key pressed, and if a key has been pressed
+	// Draw presents the display once per frame if it has changed; only the
+	// pixels within the dirty region differ from the previous call.
+	Draw(pixels Pixels, dirty Region)
 	GetKeysPressed() [16]bool
 }
 
 type Vm struct {
-	Mem       []byte
-	Stack     [16]uint16
-	Regs      [16]byte
-	I         uint16   // register used mostly to store memory addresses
-	DT        byte     // delay timer
-	ST        byte     // sound timer
-	Pc        uint16   // program counter
-	Sp        byte     // stack pointer
-	Keys      [16]bool // represents the 16-key keypad; a true value means the key corresponding key is pressed
-	Pixels    Pixels
-	IO        IO
-	Done      bool
-	repeatCnt byte
+	Mem        []byte
+	Stack      [16]uint16
+	Regs       [16]byte
+	I          uint16   // register used mostly to store memory addresses
+	DT         byte     // delay timer
+	ST         byte     // sound timer
+	Pc         uint16   // program counter
+	Sp         byte     // stack pointer
+	Keys       [16]bool // represents the 16-key keypad; a true value means the key corresponding key is pressed
+	Pixels     Pixels
+	IO         IO
+	Done       bool
+	Quirks     Quirks
+	Coverage   *Coverage  // records executed and read ROM bytes when set
+	Hooks      *Hooks     // the functions subscribed to events, see OnInstruction
+	Rand       *rand.Rand // the source of random numbers; a seeded source makes runs reproducible, see Seed
+	Buzzing    bool       // whether the buzzer sounded during the last frame
+	LastSprite Sprite     // the sprite drawn by the last Dxyn
+	dirty      Region     // the area of the display changed since it was last presented
+	randSource *randSource
+
+	Halt        HaltConfig // how the end of the program is detected and handled
+	Halted      HaltReason // why the program is over, if it is
+	keysRead    bool       // whether keys have been read since the last frame
+	lastState   uint64     // the hash of the state at the end of the last frame
+	stillFrames int        // the number of frames the state has not changed for
+
+	// Fx0A halts the program until a key is pressed and released, as on the
+	// COSMAC VIP; the timers keep ticking while waiting.
+	WaitingForKey bool
+	KeyWaitReg    byte     // the register the released key is stored in
+	keysDown      [16]bool // the keys pressed since the wait started
 }
 
+// MemorySize is the number of bytes of memory of a VM.
+const MemorySize = 0xFFF
+
 func NewVm(rom []byte, io IO) (Vm, error) {
-	if 0x200+len(rom) > 0xFFF {
+	if 0x200+len(rom) > MemorySize {
 		return Vm{}, errors.New("ROM size exceeds RAM limit")
 	}
 
@@ -58,23 +127,27 @@ func NewVm(rom []byte, io IO) (Vm, error) {
 		0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
 		0xF0, 0x80, 0xF0, 0x80, 0x80, // F
 	}
-	mem := make([]byte, 0xFFF) // initialize RAM with the first reserved 0x200 bytes
+	mem := make([]byte, MemorySize) // initialize RAM with the first reserved 0x200 bytes
 	copy(mem, hexSprites)
 	copy(mem[0x200:], rom) // copy the ROM into RAM
 
 	return Vm{
-		Mem: mem,
-		Pc:  0x200,
-		IO:  io,
+		Mem:    mem,
+		Pc:     0x200,
+		IO:     io,
+		Quirks: ChipQuirks,
+		Halt:   DefaultHalt,
 	}, nil
 }
 
-func (vm *Vm) trace(b1, b2 byte) func(string) string {
-	instInfo := fmt.Sprintf("%3x %2x %2x   ", vm.Pc, b1, b2)
-	return func(instDesc string) string {
-		assembly := fmt.Sprintf(instInfo + instDesc)
-		return assembly
+// Disassemble returns the trace of the instruction stored at addr.
+func (vm *Vm) Disassemble(addr uint16) string {
+	byte1, byte2 := vm.Mem[addr], vm.Mem[addr+1]
+	inst, err := getInstruction(byte1, byte2)
+	if err != nil {
+		return fmt.Sprintf("%3x %2x %2x   %v", addr, byte1, byte2, err)
 	}
+	return fmt.Sprintf("%3x %2x %2x   %v", addr, byte1, byte2, inst.assembly)
 }
 
 // Increment the program counter
@@ -90,6 +163,39 @@ func (vm *Vm) skipIf(cond bool) {
 	}
 }
 
+func (vm *Vm) markDirty(region Region) {
+	vm.dirty = vm.dirty.Union(region)
+}
+
+// present hands the changes made to the display during a frame to the IO.
+func (vm *Vm) present() {
+	if vm.dirty.Empty() {
+		return
+	}
+	vm.IO.Draw(vm.Pixels, vm.dirty)
+	vm.dirty = Region{}
+}
+
+// resolveKeyWait checks the keys for the wait of Fx0A and reports whether
+// it is over, i.e. a key pressed during the wait has been released.
+func (vm *Vm) resolveKeyWait() bool {
+	vm.Keys = vm.IO.GetKeysPressed()
+	vm.keysRead = true
+	for key, pressed := range vm.Keys {
+		if pressed {
+			vm.keysDown[key] = true
+		} else if vm.keysDown[key] {
+			vm.Regs[vm.KeyWaitReg] = byte(key)
+			vm.WaitingForKey = false
+			if vm.hooked() {
+				vm.emitKeyWait(false)
+			}
+			return true
+		}
+	}
+	return false
+}
+
 func (vm *Vm) setVF1If(cond bool) {
 	vm.Regs[0xF] = 0
 	if cond {
@@ -98,29 +204,50 @@ func (vm *Vm) setVF1If(cond bool) {
 }
 
 type RunParams struct {
-	instCount     int           // the number of instructions to run
-	frameDuration time.Duration // the length of a single frame in milliseconds
+	InstCount     int           // the number of instructions to run
+	FrameDuration time.Duration // the length of a single frame in milliseconds
 }
 
 func (vm *Vm) Run(params RunParams) error {
-	if params.instCount == 0 {
-		params.instCount = 10
-	}
-	if params.frameDuration == 0 {
-		params.frameDuration = 16 // approx. equivalent to 60 hz
+	if params.FrameDuration == 0 {
+		params.FrameDuration = 16 // approx. equivalent to 60 hz
 	}
 
 	// Execute a certain number of instructions within
 	// the duration of a frame
-	count := 0
 	timeout := make(chan bool, 1)
 	go func() {
-		time.Sleep(time.Millisecond * params.frameDuration)
+		time.Sleep(time.Millisecond * params.FrameDuration)
 		timeout <- true
 	}()
 
-	for count != params.instCount {
+	if err := vm.RunFrame(params); err != nil {
+		return err
+	}
+	<-timeout
+
+	return nil
+}
+
+// RunFrame executes the instructions of a single frame without waiting for
+// the frame to elapse, which lets a VM run as fast as possible when nobody
+// is watching.
+func (vm *Vm) RunFrame(params RunParams) error {
+	if params.InstCount == 0 {
+		params.InstCount = 10
+	}
+
+	for count := 0; count != params.InstCount; count++ {
+		if vm.Done || vm.WaitingForKey && !vm.resolveKeyWait() {
+			break
+		}
 		byte1, byte2 := vm.Mem[vm.Pc], vm.Mem[vm.Pc+1]
+		if vm.Coverage != nil {
+			vm.Coverage.markExecuted(vm.Pc)
+		}
+		if vm.hooked() {
+			vm.emitInstruction(vm.Pc, uint16(byte1)<<8|uint16(byte2))
+		}
 		vm.incPc()
 		// Get and execute the instruction
 		inst, err := getInstruction(byte1, byte2)
@@ -128,10 +255,9 @@ func (vm *Vm) Run(params RunParams) error {
 			return err
 		}
 		inst.execFn(vm)
-		count++
-
 	}
-	<-timeout
+	vm.present()
+	vm.checkProgress()
 
 	// Delay timer
 	// decrement the delay timer per frame
@@ -139,5 +265,15 @@ func (vm *Vm) Run(params RunParams) error {
 		vm.DT--
 	}
 
+	// Sound timer
+	// the buzzer sounds for as long as the sound timer is not zero
+	vm.Buzzing = vm.ST != 0
+	if vm.ST != 0 {
+		vm.ST--
+	}
+
+	if vm.hooked() {
+		vm.emitFrame()
+	}
 	return nil
 }
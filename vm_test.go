@@ -1,27 +1,25 @@
-package main
+package chip8
 
-import "testing"
+import (
+	"math/rand"
+	"testing"
+)
 
 var runParams RunParams = RunParams{
-	instCount:     1,
-	frameDuration: 1,
+	InstCount:     1,
+	FrameDuration: 1,
 }
 
 type TestIO struct {
-	drawCalled        bool
-	clearScreenCalled bool
+	drawCalled bool
+	drawCount  int
+	dirty      Region
 }
 
-func (testIO *TestIO) Draw(pixels Pixels) {
+func (testIO *TestIO) Draw(pixels Pixels, dirty Region) {
 	testIO.drawCalled = true
-}
-
-func (testIO *TestIO) ClearScreen() {
-	testIO.clearScreenCalled = true
-}
-
-func (testIO *TestIO) WaitKeyPress() (byte, bool) {
-	return 12, true
+	testIO.drawCount++
+	testIO.dirty = dirty
 }
 
 func (testIO *TestIO) GetKeysPressed() [16]bool {
@@ -37,10 +35,11 @@ func Test00E0(t *testing.T) {
 	ram := []byte{0x00, 0xE0}
 
 	vm, _ := NewVm(ram, testIO)
+	vm.Pixels[3][4] = 1
 
 	vm.Run(runParams)
-	if !testIO.clearScreenCalled {
-		t.Error("Clear screen instruction err; not called")
+	if vm.Pixels != (Pixels{}) || testIO.dirty != FullScreen {
+		t.Errorf("Clear screen instruction err; dirty region: %+v", testIO.dirty)
 	}
 }
 
@@ -549,7 +548,21 @@ func TestBnnn(t *testing.T) {
 }
 
 func TestCnnn(t *testing.T) {
-	t.Skip()
+	ram := []byte{0xC1, 0xFF, 0xC2, 0x0F}
+
+	results := [2][2]byte{}
+	for i := range results {
+		vm, _ := NewVm(ram, testIO)
+		vm.Rand = rand.New(rand.NewSource(8))
+		vm.Run(RunParams{InstCount: 2, FrameDuration: 1})
+		results[i] = [2]byte{vm.Regs[1], vm.Regs[2]}
+		if vm.Regs[2] > 0xF {
+			t.Errorf("Random instruction err; V2 not masked: %x", vm.Regs[2])
+		}
+	}
+	if results[0] != results[1] {
+		t.Errorf("Random instruction err; seeded runs differ: %v", results)
+	}
 }
 
 func TestDxyn(t *testing.T) {
@@ -618,6 +631,32 @@ func TestDxyn(t *testing.T) {
 	}
 }
 
+func TestDirtyRegion(t *testing.T) {
+	ram := []byte{0xD0, 0x11, 0xD2, 0x31, 0x00, 0x00, 0x80}
+
+	vm, _ := NewVm(ram, testIO)
+	vm.I = 0x206
+	vm.Regs[0], vm.Regs[1] = 4, 2
+	vm.Regs[2], vm.Regs[3] = 10, 7
+	testIO.drawCount = 0
+	vm.Run(RunParams{InstCount: 2, FrameDuration: 1})
+
+	// both sprites are presented at once at the end of the frame
+	if testIO.drawCount != 1 {
+		t.Errorf("Dirty region err; Draw called %d times", testIO.drawCount)
+	}
+	if expected := (Region{X: 4, Y: 2, W: 7, H: 6}); testIO.dirty != expected {
+		t.Errorf("Dirty region err; Expected: %+v, Received: %+v", expected, testIO.dirty)
+	}
+
+	vm.Pc = 0x200
+	vm.Run(RunParams{InstCount: 2, FrameDuration: 1})
+	vm.Run(runParams)
+	if testIO.drawCount != 2 {
+		t.Errorf("Dirty region err; Draw called for an unchanged display")
+	}
+}
+
 func TestEx9EAndExA1(t *testing.T) {
 	ram := make([]byte, 6)
 	ram[0] = 0xEA
@@ -642,13 +681,30 @@ func TestEx9EAndExA1(t *testing.T) {
 }
 
 func TestFx0A(t *testing.T) {
-	ram := []byte{0xF1, 0x0A}
+	ram := []byte{0xF1, 0x0A, 0x62, 0x01}
 
-	vm, _ := NewVm(ram, testIO)
-	vm.Run(runParams)
+	io := &HeadlessIO{}
+	vm, _ := NewVm(ram, io)
+	vm.DT = 5
+	params := RunParams{InstCount: 2, FrameDuration: 1}
+	vm.Run(params)
+	if !vm.WaitingForKey || vm.KeyWaitReg != 1 || vm.Pc != 0x202 {
+		t.Errorf("Load on key instruction err; not waiting for a key, Pc: %x", vm.Pc)
+	}
+	if vm.DT != 4 {
+		t.Errorf("Load on key instruction err; DT stopped while waiting: %x", vm.DT)
+	}
 
-	if vm.Regs[1] != 12 {
-		t.Errorf("Load on key instruction err; V1: %x", vm.Regs[1])
+	// the key is only stored once released
+	io.Keys[12] = true
+	vm.Run(params)
+	if !vm.WaitingForKey || vm.Regs[2] != 0 {
+		t.Errorf("Load on key instruction err; stopped waiting on key press")
+	}
+	io.Keys[12] = false
+	vm.Run(params)
+	if vm.WaitingForKey || vm.Regs[1] != 12 || vm.Regs[2] != 1 {
+		t.Errorf("Load on key instruction err; V1: %x, V2: %x", vm.Regs[1], vm.Regs[2])
 	}
 }
 
@@ -690,9 +746,10 @@ func TestFxInsts(t *testing.T) {
 	// 	t.Errorf("Load DT, Vx err; DT: %x", vm.DT)
 	// }
 
+	// the sound timer is decremented at the end of the frame
 	vm.Regs[3] = 0xCC
 	vm.Run(runParams)
-	if vm.ST != 0xCC {
+	if vm.ST != 0xCB || !vm.Buzzing {
 		t.Errorf("Load ST, Vx err; ST: %x", vm.ST)
 	}
 
@@ -755,3 +812,27 @@ func TestFxInsts(t *testing.T) {
 		t.Errorf("Load Vx, [I] err, I: %x", vm.I)
 	}
 }
+
+func TestQuirks(t *testing.T) {
+	ram := []byte{0x81, 0x26, 0x81, 0x21, 0xB2, 0x00}
+
+	vm, _ := NewVm(ram, testIO)
+	vm.Quirks = Quirks{Shifting: true, Jumping: true}
+	vm.Regs[1] = 0x3
+	vm.Regs[2] = 0x8
+	vm.Regs[0xF] = 0xA
+	vm.Run(runParams)
+	if vm.Regs[1] != 0x1 || vm.Regs[0xF] != 1 {
+		t.Errorf("Shifting quirk err; V1: %x, VF: %x", vm.Regs[1], vm.Regs[0xF])
+	}
+
+	vm.Run(runParams)
+	if vm.Regs[1] != 0x9 || vm.Regs[0xF] != 1 {
+		t.Errorf("VF reset quirk err; V1: %x, VF: %x", vm.Regs[1], vm.Regs[0xF])
+	}
+
+	vm.Run(runParams)
+	if vm.Pc != 0x208 {
+		t.Errorf("Jumping quirk err; Pc: %x", vm.Pc)
+	}
+}
@@ -0,0 +1,827 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/bobbynarvy/chip8"
+	"github.com/bobbynarvy/chip8/achievement"
+	"github.com/bobbynarvy/chip8/capture"
+	"github.com/bobbynarvy/chip8/cheat"
+	"github.com/bobbynarvy/chip8/keymap"
+	"github.com/bobbynarvy/chip8/loader"
+	"github.com/bobbynarvy/chip8/netplay"
+	"github.com/bobbynarvy/chip8/render"
+	"github.com/bobbynarvy/chip8/stream"
+)
+
+type RunState struct {
+	romLoaded     bool
+	inDebug       bool
+	waitingForKey bool
+}
+
+func newRunState() RunState {
+	rs := RunState{}
+	js.Global().Get("Chip8").Call("onRunStateInit", rs.toJsObj())
+	return rs
+}
+
+func (rs *RunState) setState(setter func(rs *RunState)) {
+	setter(rs)
+	js.Global().Get("Chip8").Call("onRunStateUpdate", rs.toJsObj())
+}
+
+func (rs *RunState) toJsObj() map[string]any {
+	rsObj := make(map[string]any)
+	rsObj["romLoaded"] = rs.romLoaded
+	rsObj["inDebug"] = rs.inDebug
+	rsObj["waitingForKey"] = rs.waitingForKey
+	return rsObj
+}
+
+type JsIO struct {
+	keysPressed *[16]bool
+	display     *chip8.Pixels // the last frame presented by the VM
+}
+
+// Draw only copies the pixels of the dirty region, the others being those
+// presented last.
+func (jsIO JsIO) Draw(pixels chip8.Pixels, dirty chip8.Region) {
+	for y := dirty.Y; y < dirty.Y+dirty.H; y++ {
+		copy(jsIO.display[y][dirty.X:dirty.X+dirty.W], pixels[y][dirty.X:dirty.X+dirty.W])
+	}
+}
+
+// Display renders the frames presented by the VM into an ImageData object of
+// the JS-space.
+type Display struct {
+	renderer *render.Renderer
+	palette  render.Palette // the palette chosen by the user
+	image    js.Value
+}
+
+func newDisplay() *Display {
+	d := &Display{
+		renderer: render.New(render.Options{Palette: render.Classic, Scale: 10, Ghosting: 3}),
+		palette:  render.Classic,
+		image:    js.Global().Get("ImageData").New(640, 320),
+	}
+	js.Global().Get("Chip8").Call("setDisplayImage", d.image)
+	return d
+}
+
+// render renders a frame and copies the area of the image that has changed
+// to the JS-space, row by row; it returns the changed area, or nil if nothing
+// has changed.
+func (d *Display) render(pixels *chip8.Pixels) any {
+	changed := d.renderer.Render(render.FromPixels(pixels))
+	if changed.Empty() {
+		return nil
+	}
+	img := d.renderer.Image()
+	data := d.image.Get("data")
+	for y := changed.Min.Y; y < changed.Max.Y; y++ {
+		start, end := img.PixOffset(changed.Min.X, y), img.PixOffset(changed.Max.X, y)
+		js.CopyBytesToJS(data.Call("subarray", start, end), img.Pix[start:end])
+	}
+	return []any{changed.Min.X, changed.Min.Y, changed.Dx(), changed.Dy()}
+}
+
+// usePalette sets the palette of the display; a nil palette restores the one
+// chosen by the user.
+func (d *Display) usePalette(palette render.Palette) {
+	if palette == nil {
+		palette = d.palette
+	}
+	opts := d.renderer.Options()
+	opts.Palette = palette
+	d.renderer.SetOptions(opts)
+}
+
+func (jsIO JsIO) GetKeysPressed() [16]bool {
+	return *jsIO.keysPressed
+}
+
+type romFile struct {
+	name string
+	data []byte
+}
+
+func setup() {
+	runState := newRunState()
+	runParams := chip8.RunParams{}
+	step := make(chan any, 1)
+	jsIO := JsIO{
+		keysPressed: &[16]bool{},
+		display:     &chip8.Pixels{},
+	}
+	display := newDisplay()
+	var vm chip8.Vm
+
+	js.Global().Set("toggleDebug", js.FuncOf(func(this js.Value, args []js.Value) any {
+		runState.setState(func(rs *RunState) {
+			rs.inDebug = !rs.inDebug
+			if !rs.inDebug {
+				step <- true
+			}
+		})
+		return runState.inDebug
+	}))
+
+	js.Global().Set("nextInst", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if !runState.romLoaded || vm.Done {
+			return nil
+		}
+
+		step <- true
+		return nil
+	}))
+
+	// while streaming a VM run by the server, the keys are sent to the server
+	// instead of a VM run here
+	streaming := false
+	setKey := func(key byte, pressed bool) {
+		jsIO.keysPressed[key] = pressed
+		if streaming {
+			js.Global().Get("Chip8").Call("onStreamKey", key, pressed)
+		}
+	}
+
+	js.Global().Set("setStreaming", js.FuncOf(func(this js.Value, args []js.Value) any {
+		streaming = args[0].Bool()
+		if !streaming {
+			// the VM only presents what changes on the display the stream left
+			*jsIO.display = vm.Pixels
+		}
+		return nil
+	}))
+
+	// `streamFrame` shows the changes of the display sent by the server
+	js.Global().Set("streamFrame", js.FuncOf(func(this js.Value, args []js.Value) any {
+		msg := make([]byte, args[0].Length())
+		js.CopyBytesToGo(msg, args[0])
+		if err := stream.DecodeDisplay(msg, jsIO.display); err != nil {
+			fmt.Println(err)
+		}
+		return nil
+	}))
+
+	js.Global().Set("setKey", js.FuncOf(func(this js.Value, args []js.Value) any {
+		key := args[0].Int()
+		if key < 0 || key > 0xF {
+			return fmt.Sprintf("invalid key %#x", key)
+		}
+		setKey(byte(key), args[1].Bool())
+		return nil
+	}))
+
+	// `pressInput` is called with the `KeyboardEvent.code` of a key or the name
+	// of a gamepad input; it returns whether the input is mapped to a key so
+	// that JS can prevent its default action
+	romKeymap := keymap.Default()
+	keypad := keymap.NewKeypad(romKeymap.Copy())
+	js.Global().Set("pressInput", js.FuncOf(func(this js.Value, args []js.Value) any {
+		key, ok := keypad.Input(args[0].String(), args[1].Bool())
+		if !ok {
+			return false
+		}
+		if pressed := keypad.Keys()[key]; pressed != jsIO.keysPressed[key] {
+			setKey(key, pressed)
+		}
+		return true
+	}))
+
+	releaseKeys := func() {
+		keypad.Release()
+		for key, pressed := range jsIO.keysPressed {
+			if pressed {
+				setKey(byte(key), false)
+			}
+		}
+	}
+
+	// `setKeymap` restores a keymap saved by JS in the form returned by
+	// `bindInput`; it returns an error message if the keymap is invalid
+	js.Global().Set("setKeymap", js.FuncOf(func(this js.Value, args []js.Value) any {
+		k, err := keymap.Decode([]byte(args[0].String()))
+		if err != nil {
+			return err.Error()
+		}
+		releaseKeys()
+		keypad.Keymap = k
+		return nil
+	}))
+
+	js.Global().Set("bindInput", js.FuncOf(func(this js.Value, args []js.Value) any {
+		releaseKeys()
+		if err := keypad.Keymap.Bind(args[0].String(), byte(args[1].Int())); err != nil {
+			fmt.Println(err)
+		}
+		return string(keypad.Keymap.Encode())
+	}))
+
+	// `resetKeymap` restores the keymap of the ROM loaded
+	js.Global().Set("resetKeymap", js.FuncOf(func(this js.Value, args []js.Value) any {
+		releaseKeys()
+		keypad.Keymap = romKeymap.Copy()
+		return nil
+	}))
+
+	js.Global().Set("keymapInputs", js.FuncOf(func(this js.Value, args []js.Value) any {
+		inputs := make([]any, 16)
+		for key := range inputs {
+			keyInputs := []any{}
+			for _, input := range keypad.Keymap.Inputs(byte(key)) {
+				keyInputs = append(keyInputs, input)
+			}
+			inputs[key] = keyInputs
+		}
+		return inputs
+	}))
+
+	js.Global().Set("setInstsPerFrame", js.FuncOf(func(this js.Value, args []js.Value) any {
+		runParams.InstCount = args[0].Int()
+		return nil
+	}))
+
+	js.Global().Set("renderDisplay", js.FuncOf(func(this js.Value, args []js.Value) any {
+		return display.render(jsIO.display)
+	}))
+
+	js.Global().Set("setRenderOptions", js.FuncOf(func(this js.Value, args []js.Value) any {
+		palette, ok := render.Palettes[args[0].String()]
+		if !ok {
+			palette = render.Classic
+		}
+		display.palette = palette
+		display.renderer.SetOptions(render.Options{
+			Palette:   palette,
+			Scale:     10,
+			Scanlines: args[1].Float(),
+			Ghosting:  args[2].Int(),
+		})
+		return nil
+	}))
+
+	js.Global().Set("screenshot", js.FuncOf(func(this js.Value, args []js.Value) any {
+		var png bytes.Buffer
+		if err := capture.WritePNG(&png, *jsIO.display, display.renderer.Options()); err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		return toJsBytes(png.Bytes())
+	}))
+
+	// `toggleRecording` starts capturing the frames of the display and returns
+	// them as an animated GIF once called again
+	var recorder *capture.Recorder
+	js.Global().Set("toggleRecording", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if recorder == nil {
+			opts := display.renderer.Options()
+			opts.Scale = 4
+			recorder = capture.NewRecorder(opts)
+			return nil
+		}
+		var anim bytes.Buffer
+		err := recorder.WriteGIF(&anim)
+		recorder = nil
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		return toJsBytes(anim.Bytes())
+	}))
+
+	js.Global().Set("coverageReport", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if !runState.romLoaded || vm.Coverage == nil {
+			return nil
+		}
+		format, romName := args[0].String(), args[1].String()
+		var report strings.Builder
+		var err error
+		if format == "lcov" {
+			err = vm.Coverage.WriteLCOV(&report, vm.Mem, romName)
+		} else {
+			err = vm.Coverage.WriteHTML(&report, vm.Mem, romName)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		return report.String()
+	}))
+
+	js.Global().Set("memoryPage", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if !runState.romLoaded {
+			return nil
+		}
+		page := args[0].Int()
+		rows := []any{}
+		for _, row := range vm.MemoryPage(page) {
+			values := make([]any, len(row.Bytes))
+			marks := make([]any, len(row.Marks))
+			for i := range row.Bytes {
+				values[i] = row.Bytes[i]
+				marks[i] = uint8(row.Marks[i])
+			}
+			rows = append(rows, map[string]any{
+				"addr":  row.Addr,
+				"bytes": values,
+				"marks": marks,
+				"ascii": row.ASCII,
+			})
+		}
+		return map[string]any{"page": page, "pages": vm.Pages(), "rows": rows}
+	}))
+
+	// `editVm` applies an edit made in the debug panel and returns an error
+	// message if it cannot be made; edits are only allowed while paused
+	editVm := func(edit func() error) any {
+		if !runState.romLoaded || !runState.inDebug {
+			return "the VM can only be edited in debug mode"
+		}
+		if err := edit(); err != nil {
+			return err.Error()
+		}
+		vmState(&vm)()
+		return nil
+	}
+
+	js.Global().Set("pokeMemory", js.FuncOf(func(this js.Value, args []js.Value) any {
+		return editVm(func() error {
+			return vm.Poke(uint16(args[0].Int()), byte(args[1].Int()))
+		})
+	}))
+
+	js.Global().Set("setRegister", js.FuncOf(func(this js.Value, args []js.Value) any {
+		return editVm(func() error {
+			return vm.SetRegister(args[0].String(), args[1].Int())
+		})
+	}))
+
+	js.Global().Set("disassemble", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if !runState.romLoaded {
+			return nil
+		}
+		return vm.Disassemble(uint16(args[0].Int()))
+	}))
+
+	// `spriteSheet` renders sprites read from memory; the arguments are the
+	// address, the height and the number of sprites, and if they are 16x16
+	spriteSheet := func(args []js.Value) render.SpriteSheet {
+		return render.SpriteSheet{
+			Mem:    vm.Mem,
+			Addr:   args[0].Int(),
+			Height: args[1].Int(),
+			Count:  args[2].Int(),
+			Wide:   args[3].Bool(),
+		}
+	}
+	spriteOptions := render.Options{Palette: render.Classic, Scale: 4}
+	js.Global().Set("spriteSheet", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if !runState.romLoaded {
+			return nil
+		}
+		r := render.New(spriteOptions)
+		r.Render(spriteSheet(args))
+		img := r.Image()
+		if img.Rect.Empty() {
+			return nil
+		}
+		return map[string]any{
+			"width":  img.Rect.Dx(),
+			"height": img.Rect.Dy(),
+			"data":   toJsBytes(img.Pix),
+		}
+	}))
+
+	js.Global().Set("spriteSheetPNG", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if !runState.romLoaded {
+			return nil
+		}
+		var png bytes.Buffer
+		if err := capture.WriteFramePNG(&png, spriteSheet(args), spriteOptions); err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		return toJsBytes(png.Bytes())
+	}))
+
+	// `cheatSearch` starts or narrows down a search of memory; the operation is
+	// one of "new", "value", "unchanged", "changed", "increased" and "decreased"
+	var search *cheat.Search
+	comparisons := map[string]cheat.Comparison{
+		"unchanged": cheat.Unchanged,
+		"changed":   cheat.Changed,
+		"increased": cheat.Increased,
+		"decreased": cheat.Decreased,
+	}
+	js.Global().Set("cheatSearch", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if !runState.romLoaded {
+			return nil
+		}
+		op := args[0].String()
+		if op == "new" || search == nil {
+			search = cheat.NewSearch(&vm)
+		}
+		if op == "value" {
+			search.Value(&vm, byte(args[1].Int()))
+		} else if cmp, ok := comparisons[op]; ok {
+			search.Compare(&vm, cmp)
+		}
+		results := []any{}
+		for _, addr := range search.Results() {
+			if len(results) == 64 { // only show the first results
+				break
+			}
+			results = append(results, []any{addr, vm.Mem[addr]})
+		}
+		return map[string]any{"count": len(search.Results()), "results": results}
+	}))
+
+	cheats := &cheat.Codes{}
+	// `setCheats` restores the cheats saved by JS in the form returned by
+	// `cheatCodes`; it returns an error message if they are invalid
+	js.Global().Set("setCheats", js.FuncOf(func(this js.Value, args []js.Value) any {
+		codes, err := cheat.Decode([]byte(args[0].String()))
+		if err != nil {
+			return err.Error()
+		}
+		cheats = codes
+		return nil
+	}))
+
+	js.Global().Set("addCheat", js.FuncOf(func(this js.Value, args []js.Value) any {
+		code, err := cheat.ParseCode(args[0].String())
+		if err != nil {
+			return err.Error()
+		}
+		code.Name = args[1].String()
+		cheats.Add(code)
+		return nil
+	}))
+
+	js.Global().Set("enableCheat", js.FuncOf(func(this js.Value, args []js.Value) any {
+		cheats.SetEnabled(args[0].Int(), args[1].Bool())
+		return nil
+	}))
+
+	js.Global().Set("removeCheat", js.FuncOf(func(this js.Value, args []js.Value) any {
+		cheats.Remove(args[0].Int())
+		return nil
+	}))
+
+	js.Global().Set("cheatCodes", js.FuncOf(func(this js.Value, args []js.Value) any {
+		list := make([]any, len(cheats.List))
+		for i, code := range cheats.List {
+			list[i] = map[string]any{"name": code.Name, "code": code.String(), "enabled": code.Enabled}
+		}
+		return map[string]any{"list": list, "saved": string(cheats.Encode())}
+	}))
+
+	// `setAchievements` sets the achievements of ROMs, as defined in the JSON
+	// file fetched by JS; it returns an error message if they are invalid
+	achievementDefs := achievement.Definitions{}
+	achievements := &achievement.Set{}
+	js.Global().Set("setAchievements", js.FuncOf(func(this js.Value, args []js.Value) any {
+		defs, err := achievement.Decode([]byte(args[0].String()))
+		if err != nil {
+			return err.Error()
+		}
+		achievementDefs = defs
+		return nil
+	}))
+
+	// `restoreAchievements` unlocks the achievements saved by JS in the form
+	// returned by `achievementList`
+	js.Global().Set("restoreAchievements", js.FuncOf(func(this js.Value, args []js.Value) any {
+		var ids []string
+		if err := json.Unmarshal([]byte(args[0].String()), &ids); err != nil {
+			return err.Error()
+		}
+		achievements.Restore(ids)
+		return nil
+	}))
+
+	js.Global().Set("achievementList", js.FuncOf(func(this js.Value, args []js.Value) any {
+		list := make([]any, len(achievements.Achievements))
+		for i, a := range achievements.Achievements {
+			list[i] = map[string]any{"title": a.Title, "description": a.Description, "unlocked": a.Unlocked}
+		}
+		saved, _ := json.Marshal(achievements.Unlocked())
+		return map[string]any{"list": list, "saved": string(saved)}
+	}))
+
+	haltPolicy := chip8.HaltStop
+	js.Global().Set("setHaltPolicy", js.FuncOf(func(this js.Value, args []js.Value) any {
+		haltPolicy = chip8.HaltPolicies[args[0].String()]
+		vm.Halt.Policy = haltPolicy
+		return nil
+	}))
+
+	// `createNewVm` will be called from JS-space and thus from another goroutine;
+	// better to keep everything in a single goroutine as much as possible so let's
+	// make a channel that will expect files coming from JS. In effect, this
+	// function will be a blocking one until `createNewVm` is called from JS.
+	rom := make(chan romFile, 1)
+	js.Global().Set("createNewVm", js.FuncOf(func(this js.Value, args []js.Value) any {
+		// args should be the file name and a Uint8Array of its contents;
+		// copy the whole array at once into bytes that can be used by the VM
+		bytes := make([]byte, args[1].Length())
+		js.CopyBytesToGo(bytes, args[1])
+		rom <- romFile{name: args[0].String(), data: bytes}
+		return nil
+	}))
+
+	js.Global().Set("bootFromFragment", js.FuncOf(func(this js.Value, args []js.Value) any {
+		name, data, err := loader.ParseFragment(args[0].String())
+		if err != nil {
+			return err.Error()
+		}
+		rom <- romFile{name: name, data: data}
+		return nil
+	}))
+
+	loop := make(chan bool, 1)
+
+	// netplay; JS relays the messages of the room it joined and Go runs the
+	// session, the events about the room being handled by the loop
+	var netplaySession *netplay.Session
+	var netplayStart *netplay.Message // the game started by the other player
+	netplayPlayer, netplayPeer, netplayDelay := -1, false, 2
+	netplayEvents := make(chan netplay.Message, 4)
+	sendNetplay := func(msg netplay.Message) {
+		data, _ := json.Marshal(msg)
+		js.Global().Get("Chip8").Call("onNetplaySend", string(data))
+	}
+	netplayStatus := func(format string, args ...any) {
+		js.Global().Get("Chip8").Call("onNetplayStatus", fmt.Sprintf(format, args...))
+	}
+	js.Global().Set("setNetplayDelay", js.FuncOf(func(this js.Value, args []js.Value) any {
+		netplayDelay = args[0].Int()
+		return nil
+	}))
+	js.Global().Set("netplayMessage", js.FuncOf(func(this js.Value, args []js.Value) any {
+		var msg netplay.Message
+		if err := json.Unmarshal([]byte(args[0].String()), &msg); err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		switch msg.Type {
+		case netplay.Input, netplay.Hash:
+			if netplaySession != nil {
+				netplaySession.Receive(msg)
+			}
+		default:
+			netplayEvents <- msg
+		}
+		return nil
+	}))
+	js.Global().Set("leaveNetplay", js.FuncOf(func(this js.Value, args []js.Value) any {
+		netplayEvents <- netplay.Message{Type: "leave"}
+		return nil
+	}))
+	stopNetplay := func() {
+		if netplaySession != nil {
+			netplaySession.Close()
+			netplaySession = nil
+		}
+	}
+	// startNetplay starts a game once both players are in the room: the first
+	// player starts it with the ROM loaded, and the second one joins it once
+	// the same ROM is loaded. Both VMs boot anew with the same seed.
+	var loadedRom loader.Rom
+	startNetplay := func() {
+		if netplaySession != nil || !netplayPeer || !runState.romLoaded {
+			return
+		}
+		start := netplayStart
+		switch {
+		case netplayPlayer == 0:
+			start = &netplay.Message{
+				Type:  netplay.Start,
+				Hash:  loadedRom.Metadata.Hash,
+				Seed:  rand.Int63(),
+				Ticks: runParams.InstCount,
+				Delay: netplayDelay,
+			}
+			sendNetplay(*start)
+		case start == nil:
+			netplayStatus("Waiting for player 1 to start")
+			return
+		case start.Hash != loadedRom.Metadata.Hash:
+			netplayStatus("Load the ROM player 1 plays to start")
+			return
+		}
+		netplayStart = nil
+		newVm, newRunParams, err := loadedRom.Boot(jsIO)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		vm, runParams = newVm, newRunParams
+		vm.Seed(start.Seed)
+		vm.Halt.Policy = haltPolicy
+		runParams.InstCount = start.Ticks
+		*jsIO.display = chip8.Pixels{}
+		netplaySession = netplay.NewSession(&vm, runParams, start.Delay, sendNetplay)
+		netplayStatus("Playing as player %d", netplayPlayer+1)
+		select {
+		case loop <- true:
+		default:
+		}
+	}
+
+	for {
+		select {
+		case msg := <-netplayEvents:
+			switch msg.Type {
+			case netplay.Joined:
+				netplayPlayer = msg.Player
+				netplayStatus("Joined as player %d; waiting for the other player", netplayPlayer+1)
+			case netplay.Peer:
+				netplayPeer = true
+				startNetplay()
+			case netplay.Start:
+				netplayStart = &msg
+				startNetplay()
+			case netplay.Left:
+				stopNetplay()
+				netplayPeer = false
+				netplayStatus("The other player left")
+			case "leave":
+				stopNetplay()
+				netplayPlayer, netplayPeer, netplayStart = -1, false, nil
+				netplayStatus("")
+			}
+		case file := <-rom:
+			newRom, err := loader.Load(file.name, file.data)
+			if err != nil {
+				fmt.Println(err)
+				js.Global().Get("Chip8").Call("onRomError", err.Error())
+				continue
+			}
+			newVm, newRunParams, err := newRom.Boot(jsIO)
+			if err != nil { // e.g. a ROM too large for the memory; the previous ROM keeps running
+				fmt.Println(err)
+				js.Global().Get("Chip8").Call("onRomError", err.Error())
+				continue
+			}
+			stopNetplay()
+			loadedRom = newRom
+			runState = newRunState()
+			jsIO.keysPressed = &[16]bool{}
+			cheats, search = &cheat.Codes{}, nil
+			romKeymap = keymap.ForActions(newRom.Metadata.Keys)
+			keypad = keymap.NewKeypad(romKeymap.Copy())
+			*jsIO.display = chip8.Pixels{} // clear what the previous ROM left on the display
+			var palette render.Palette
+			if colors := newRom.Metadata.Colors; colors != nil {
+				palette, _ = render.ParsePalette(colors.Pixels)
+			}
+			display.usePalette(palette)
+			vm = newVm
+			runParams = newRunParams
+			vm.Coverage = chip8.NewCoverage(len(newRom.Data))
+			vm.Halt.Policy = haltPolicy
+			achievements = achievementDefs.Set(newRom.Metadata.Hash)
+			achievements.Attach(&vm, func(a *achievement.Achievement) {
+				js.Global().Get("Chip8").Call("onAchievement", a.Title, a.Description)
+			})
+			// the touch keypad only shows the keys the ROM uses when they are known
+			var touchKeys any
+			if keys, ok := keymap.MinimalKeypad(chip8.AnalyzeKeys(newRom.Data), newRom.Metadata.Keys); ok {
+				used := []any{}
+				for key, isUsed := range keys {
+					if isUsed {
+						used = append(used, key)
+					}
+				}
+				touchKeys = used
+			}
+			js.Global().Get("Chip8").Call("onRomLoaded", metadataToJsObj(newRom.Metadata), touchKeys)
+			runState.setState(func(rs *RunState) { rs.romLoaded = true })
+			startNetplay()
+
+			// start the run loop
+			select {
+			case loop <- true:
+			default: // if the loop channel has already been filled, do nothing
+			}
+		case <-loop:
+			commVmState := vmState(&vm)
+			if runState.inDebug {
+				<-step
+				runParams.InstCount = 1
+				runParams.FrameDuration = 1
+				commVmState()
+			}
+
+			if vm.Done {
+				fmt.Println("Program executed.")
+				continue
+			}
+
+			halted, done := vm.Halted, vm.Done
+			if netplaySession != nil {
+				// cheats would desync the VMs
+				err := netplaySession.Advance(*jsIO.keysPressed)
+				time.Sleep(time.Second / 60)
+				if frame := netplaySession.Frame(); err != nil {
+					// the VMs can no longer be kept in lockstep
+					stopNetplay()
+					netplayStatus("The game stopped at frame %d: %v", frame, err)
+				} else if netplaySession.Desync != -1 {
+					netplayStatus("Desynced since frame %d", netplaySession.Desync)
+				} else if frame%60 == 0 || netplaySession.Stalled() {
+					stalled := ""
+					if netplaySession.Stalled() {
+						stalled = "; waiting for the other player"
+					}
+					netplayStatus("Playing as player %d, frame %d, %d frames rolled back%s",
+						netplayPlayer+1, frame, netplaySession.Rollbacks, stalled)
+				}
+			} else {
+				cheats.Apply(&vm)
+				if err := vm.Run(runParams); err != nil {
+					fmt.Println(err)
+				}
+			}
+			if vm.Halted != halted || vm.Done != done { // a self-jump only stops once the buzzer is silent
+				js.Global().Get("Chip8").Call("onHalt", vm.Halted.String(), vm.Done)
+			}
+			if vm.WaitingForKey != runState.waitingForKey {
+				runState.setState(func(rs *RunState) { rs.waitingForKey = vm.WaitingForKey })
+			}
+			if recorder != nil {
+				recorder.Capture(*jsIO.display)
+			}
+			loop <- true
+		}
+	}
+}
+
+func toJsBytes(data []byte) js.Value {
+	array := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(array, data)
+	return array
+}
+
+func metadataToJsObj(meta loader.Metadata) map[string]any {
+	metaObj := make(map[string]any)
+	metaObj["hash"] = meta.Hash
+	metaObj["known"] = meta.Known
+	metaObj["title"] = meta.Title
+	metaObj["platform"] = meta.Platform
+	metaObj["tickrate"] = meta.Tickrate
+	authors := make([]any, len(meta.Authors))
+	for i, author := range meta.Authors {
+		authors[i] = author
+	}
+	metaObj["authors"] = authors
+	if meta.Colors != nil {
+		pixels := make([]any, len(meta.Colors.Pixels))
+		for i, color := range meta.Colors.Pixels {
+			pixels[i] = color
+		}
+		metaObj["colors"] = map[string]any{
+			"pixels":  pixels,
+			"buzzer":  meta.Colors.Buzzer,
+			"silence": meta.Colors.Silence,
+		}
+	}
+	return metaObj
+}
+
+func vmState(vm *chip8.Vm) func() {
+	stack := make([]any, len(vm.Stack))
+	regs := make([]any, len(vm.Regs))
+	return func() {
+		for i, v := range vm.Stack {
+			stack[i] = v
+		}
+		for i, v := range vm.Regs {
+			regs[i] = v
+		}
+		state := make(map[string]any)
+		state["I"] = vm.I
+		state["Pc"] = vm.Pc
+		state["Sp"] = vm.Sp
+		state["DT"] = vm.DT
+		state["ST"] = vm.ST
+		state["Stack"] = stack
+		state["Done"] = vm.Done
+		state["Regs"] = regs
+		state["Assembly"] = vm.Disassemble(vm.Pc)
+		state["LastSprite"] = map[string]any{"addr": vm.LastSprite.Addr, "height": vm.LastSprite.Height}
+		js.Global().Get("Chip8").Call("onVmUpdate", state)
+	}
+}
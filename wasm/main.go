@@ -1,10 +1,14 @@
+//go:build js && wasm
+
 package main
 
 import (
 	"fmt"
+
+	"github.com/bobbynarvy/chip8"
 )
 
-var currentVm Vm
+var currentVm chip8.Vm
 
 func main() {
 	fmt.Println("Init WASM")